@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"log"
+	"time"
 
 	pb "github.com/danikarik/product-storage/pkg/store"
 	"google.golang.org/grpc"
@@ -33,12 +34,12 @@ func main() {
 
 	resp, err := c.List(ctx, &pb.ListRequest{
 		Paging:  &pb.Paging{Limit: 5},
-		Sorting: &pb.Sorting{Field: pb.Field_NAME, Direction: pb.Direction_DESC},
+		Sorting: []*pb.Sorting{{Field: pb.Field_NAME, Direction: pb.Direction_DESC}},
 	})
 
 	log.Println(resp.LastId)
 
 	for _, p := range resp.Products {
-		log.Printf("%s | %f | %d | %s \n", p.Name, p.Price, p.NumOfChanges, p.LastUpdate)
+		log.Printf("%s | %f | %d | %s \n", p.Name, p.Price, p.NumOfChanges, p.UpdatedAt.AsTime().Format(time.RFC3339))
 	}
 }
@@ -6,13 +6,17 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/danikarik/product-storage/pkg/api"
+	"github.com/danikarik/product-storage/pkg/outbox"
 	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/stale"
+	"github.com/danikarik/product-storage/pkg/webhook"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -21,6 +25,24 @@ var (
 	addr    = flag.String("http.addr", ":50051", "address to listen")
 	dbhost  = flag.String("db.host", "mongodb://localhost:27017", "mongo host address")
 	timeout = flag.Duration("fetch.timeout", 30*time.Second, "address for listening")
+	migrate = flag.Bool("db.migrate", false, "upgrade records saved by previous versions on start")
+
+	outboxEnabled  = flag.Bool("outbox.enabled", false, "record price changes to the outbox and relay them, requires mongo replica set")
+	outboxInterval = flag.Duration("outbox.interval", time.Second, "interval between outbox polls")
+	outboxStdout   = flag.Bool("outbox.stdout", false, "print relayed events to stdout for debugging")
+
+	webhookTimeout     = flag.Duration("webhook.timeout", 10*time.Second, "timeout of webhook requests")
+	webhookMaxAttempts = flag.Int("webhook.max_attempts", 10, "failed webhook attempts before delivery is dead-lettered")
+
+	staleAfter    = flag.Duration("stale.after", 0, "flag products missing from imports for longer, zero disables detection")
+	staleInterval = flag.Duration("stale.interval", time.Hour, "interval between stale product checks")
+
+	retention = flag.Duration("product.retention", 30*24*time.Hour, "period after deletion when product can not be purged")
+
+	minPrice    = flag.String("rules.min_price", "", "quarantine imported prices below the value")
+	maxPrice    = flag.String("rules.max_price", "", "quarantine imported prices above the value")
+	maxChange   = flag.Float64("rules.max_change", 0, "quarantine imported prices changed by more percents")
+	nonPositive = flag.Bool("rules.allow_non_positive", false, "accept zero and negative imported prices")
 )
 
 func main() {
@@ -28,6 +50,11 @@ func main() {
 
 	flag.Parse()
 
+	rules, err := buildRules()
+	if err != nil {
+		log.Fatalf("validation rules: %v", err)
+	}
+
 	listener, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Fatalf("net listener: %v", err)
@@ -43,20 +70,85 @@ func main() {
 	}
 	defer conn.Disconnect(ctx)
 
+	var repoOpts []repo.MongoOption
+	if *outboxEnabled {
+		repoOpts = append(repoOpts, repo.WithOutbox())
+	}
+
+	store := repo.NewMongoRepo("productstore", conn, repoOpts...)
+
+	if idx, ok := store.(repo.Indexer); ok {
+		if err := idx.EnsureIndexes(ctx); err != nil {
+			log.Fatalf("mongo indexes: %v", err)
+		}
+	}
+
+	if m, ok := store.(repo.Migrator); ok {
+		if *migrate {
+			n, err := m.MigrateDecimalPrices(ctx)
+			if err != nil {
+				log.Fatalf("price migration: %v", err)
+			}
+			log.Printf("migrated %d products to decimal prices", n)
+		}
+
+		// sorting and keyset paging skip products missing sorting fields,
+		// so they are filled before serving
+		n, err := m.MigrateChangeStats(ctx)
+		if err != nil {
+			log.Fatalf("change stats migration: %v", err)
+		}
+		if n > 0 {
+			log.Printf("migrated %d products to change stats", n)
+		}
+	}
+
 	var (
 		exit = make(chan error, 1)
-		srv  = api.NewServer(
-			repo.NewMongoRepo("productstore", conn),
-			&api.Options{Timeout: *timeout},
-		)
+		srv  = api.NewServer(store, &api.Options{Timeout: *timeout, Rules: rules, Retention: *retention})
 	)
 
 	go func() {
-		c := make(chan os.Signal)
+		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
 		exit <- fmt.Errorf("%s", <-c)
 	}()
 
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	defer stopRelay()
+
+	if *outboxEnabled {
+		dispatcher := webhook.NewDispatcher(store.(repo.Webhooks), &http.Client{}, &webhook.Options{
+			Interval:    *outboxInterval,
+			MaxAttempts: *webhookMaxAttempts,
+			Timeout:     *webhookTimeout,
+			OnError:     func(err error) { log.Printf("webhook dispatcher: %v", err) },
+		})
+
+		sinks := []outbox.Sink{dispatcher}
+		if *outboxStdout {
+			sinks = append(sinks, outbox.NewWriterSink(os.Stdout))
+		}
+
+		relay := outbox.NewRelay(store.(repo.Outbox), sinks, &outbox.Options{
+			Interval: *outboxInterval,
+			OnError:  func(err error) { log.Printf("outbox relay: %v", err) },
+		})
+
+		go relay.Run(relayCtx)
+		go dispatcher.Run(relayCtx)
+	}
+
+	if tracker, ok := store.(repo.StaleTracker); ok && *staleAfter > 0 {
+		detector := stale.NewDetector(tracker, &stale.Options{
+			Interval: *staleInterval,
+			After:    *staleAfter,
+			OnError:  func(err error) { log.Printf("stale detector: %v", err) },
+		})
+
+		go detector.Run(relayCtx)
+	}
+
 	go func() {
 		log.Println("start listening on: " + *addr)
 		exit <- srv.Serve(listener)
@@ -71,3 +163,28 @@ func main() {
 		log.Fatalf("shutdown failed: %v", err)
 	}
 }
+
+func buildRules() (api.Rules, error) {
+	rules := api.Rules{
+		MaxChangePercent: *maxChange,
+		AllowNonPositive: *nonPositive,
+	}
+
+	if *minPrice != "" {
+		price, err := repo.ParseAmount(*minPrice)
+		if err != nil {
+			return rules, err
+		}
+		rules.MinPrice = price
+	}
+
+	if *maxPrice != "" {
+		price, err := repo.ParseAmount(*maxPrice)
+		if err != nil {
+			return rules, err
+		}
+		rules.MaxPrice = price
+	}
+
+	return rules, nil
+}
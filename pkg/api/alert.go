@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) alerts() (repo.Alerts, error) {
+	a, ok := s.repo.(repo.Alerts)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "alerts are not supported by repository")
+	}
+
+	return a, nil
+}
+
+func (s *server) CreateAlertRule(ctx context.Context, in *pb.CreateAlertRuleRequest) (*pb.CreateAlertRuleResponse, error) {
+	a, err := s.alerts()
+	if err != nil {
+		return nil, err
+	}
+
+	rule, err := buildAlertRule(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.SaveAlertRule(ctx, rule); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not save alert rule")
+	}
+
+	return &pb.CreateAlertRuleResponse{Rule: newAlertRule(rule)}, nil
+}
+
+func buildAlertRule(in *pb.CreateAlertRuleRequest) (*repo.AlertRule, error) {
+	if in.Owner == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "owner must be specified")
+	}
+
+	if in.Name == "" && in.NamePrefix == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name or name prefix must be specified")
+	}
+
+	rule := &repo.AlertRule{
+		Owner:      in.Owner,
+		Name:       in.Name,
+		NamePrefix: in.NamePrefix,
+		Kind:       repo.AlertKind(in.Kind),
+	}
+
+	switch in.Kind {
+	case pb.AlertKind_BELOW, pb.AlertKind_ABOVE:
+		if in.Threshold == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "threshold must be specified")
+		}
+
+		amount, currency, err := parseMoney(in.Threshold)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid threshold: %v", err)
+		}
+
+		if currency == "" {
+			currency = repo.DefaultCurrency
+		}
+
+		rule.Threshold = amount
+		rule.Currency = currency
+	case pb.AlertKind_CHANGE_PERCENT:
+		if in.Percent == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "percent must not be zero")
+		}
+
+		rule.Percent = in.Percent
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown alert kind")
+	}
+
+	return rule, nil
+}
+
+func newAlertRule(r *repo.AlertRule) *pb.AlertRule {
+	resp := &pb.AlertRule{
+		Id:         r.ID.Hex(),
+		Owner:      r.Owner,
+		Name:       r.Name,
+		NamePrefix: r.NamePrefix,
+		Kind:       pb.AlertKind(r.Kind),
+		Percent:    r.Percent,
+		CreatedAt:  newTimestamp(r.CreatedAt),
+	}
+
+	if r.Kind != repo.AlertChangePercent {
+		resp.Threshold = newMoney(r.Threshold, r.Currency)
+	}
+
+	return resp
+}
+
+func (s *server) DeleteAlertRule(ctx context.Context, in *pb.DeleteAlertRuleRequest) (*pb.DeleteAlertRuleResponse, error) {
+	a, err := s.alerts()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	err = a.DeleteAlertRule(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "alert rule not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not delete alert rule")
+	}
+
+	return &pb.DeleteAlertRuleResponse{}, nil
+}
+
+func (s *server) ListAlertRules(ctx context.Context, in *pb.ListAlertRulesRequest) (*pb.ListAlertRulesResponse, error) {
+	a, err := s.alerts()
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := a.ListAlertRules(ctx, in.Owner)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve alert rules")
+	}
+
+	resp := &pb.ListAlertRulesResponse{
+		Rules: make([]*pb.AlertRule, 0, len(rules)),
+	}
+
+	for i := range rules {
+		resp.Rules = append(resp.Rules, newAlertRule(&rules[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *server) ListTriggeredAlerts(ctx context.Context, in *pb.ListTriggeredAlertsRequest) (*pb.ListTriggeredAlertsResponse, error) {
+	a, err := s.alerts()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &repo.AlertFilter{Owner: in.Owner}
+	if in.RuleId != "" {
+		filter.RuleID, err = primitive.ObjectIDFromHex(in.RuleId)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid rule id")
+		}
+	}
+
+	paging := &repo.Pager{}
+	if in.Paging != nil {
+		paging.Limit = in.Paging.Limit
+
+		if in.Paging.LastId != "" {
+			id, err := primitive.ObjectIDFromHex(in.Paging.LastId)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+			}
+
+			paging.LastID = id
+		}
+	}
+
+	alerts, err := a.ListTriggeredAlerts(ctx, filter, paging)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve alerts")
+	}
+
+	resp := &pb.ListTriggeredAlertsResponse{
+		LastId: "",
+		Alerts: make([]*pb.TriggeredAlert, 0, len(alerts)),
+	}
+
+	if len(alerts) > 0 {
+		resp.LastId = alerts[len(alerts)-1].ID.Hex()
+	}
+
+	for _, t := range alerts {
+		alert := &pb.TriggeredAlert{
+			Id:            t.ID.Hex(),
+			RuleId:        t.RuleID.Hex(),
+			Owner:         t.Owner,
+			ProductId:     t.ProductID.Hex(),
+			Name:          t.Name,
+			Kind:          pb.AlertKind(t.Kind),
+			Price:         newMoney(t.Price, t.Currency),
+			ChangePercent: t.ChangePercent,
+			TriggeredAt:   newTimestamp(t.TriggeredAt),
+		}
+
+		if t.OldPrice != nil {
+			alert.OldPrice = newMoney(*t.OldPrice, t.Currency)
+		}
+
+		resp.Alerts = append(resp.Alerts, alert)
+	}
+
+	return resp, nil
+}
+
+// evaluateAlerts fires rules crossed by the last price change of saved
+// product. Alerts are deduplicated by repository, so the same change may be
+// evaluated more than once.
+func (s *server) evaluateAlerts(ctx context.Context, rules []repo.AlertRule, name string) error {
+	a, ok := s.repo.(repo.Alerts)
+	if !ok || len(rules) == 0 {
+		return nil
+	}
+
+	p, err := s.repo.FindByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for i := range rules {
+		alert := rules[i].Evaluate(p)
+		if alert == nil {
+			continue
+		}
+
+		if _, err := a.TriggerAlert(ctx, alert); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alertRules returns all the alert rules, it is empty if alerts are not
+// supported by repository.
+func (s *server) alertRules(ctx context.Context) ([]repo.AlertRule, error) {
+	a, ok := s.repo.(repo.Alerts)
+	if !ok {
+		return nil, nil
+	}
+
+	return a.ListAlertRules(ctx, "")
+}
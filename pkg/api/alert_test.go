@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBuildAlertRule(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Request *store.CreateAlertRuleRequest
+		Code    codes.Code
+	}{
+		{
+			Name: "Below",
+			Request: &store.CreateAlertRuleRequest{
+				Owner:     "alice",
+				Name:      "iPhone 12",
+				Kind:      store.AlertKind_BELOW,
+				Threshold: &store.Money{Units: 900},
+			},
+		},
+		{
+			Name: "ChangePercent",
+			Request: &store.CreateAlertRuleRequest{
+				Owner:      "alice",
+				NamePrefix: "iPhone",
+				Kind:       store.AlertKind_CHANGE_PERCENT,
+				Percent:    -10,
+			},
+		},
+		{
+			Name:    "MissingOwner",
+			Request: &store.CreateAlertRuleRequest{Name: "iPhone 12", Threshold: &store.Money{Units: 900}},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "MissingMatcher",
+			Request: &store.CreateAlertRuleRequest{Owner: "alice", Threshold: &store.Money{Units: 900}},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "MissingThreshold",
+			Request: &store.CreateAlertRuleRequest{Owner: "alice", Name: "iPhone 12", Kind: store.AlertKind_ABOVE},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "ZeroPercent",
+			Request: &store.CreateAlertRuleRequest{Owner: "alice", Name: "iPhone 12", Kind: store.AlertKind_CHANGE_PERCENT},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "UnknownKind",
+			Request: &store.CreateAlertRuleRequest{Owner: "alice", Name: "iPhone 12", Kind: 10},
+			Code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			rule, err := buildAlertRule(tc.Request)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+
+			resp := newAlertRule(rule)
+			r.Equal(tc.Request.Kind, resp.Kind)
+			r.Equal(tc.Request.Percent, resp.Percent)
+
+			if tc.Request.Threshold != nil {
+				r.Equal(repo.DefaultCurrency, rule.Currency)
+				r.Equal(tc.Request.Threshold.Units, resp.Threshold.Units)
+			} else {
+				r.Nil(resp.Threshold)
+			}
+		})
+	}
+}
+
+func TestReadCSVAlerts(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	s := &server{
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+	}
+
+	rule, err := s.CreateAlertRule(ctx, &store.CreateAlertRuleRequest{
+		Owner:     "alice",
+		Name:      "iPhone 12",
+		Kind:      store.AlertKind_BELOW,
+		Threshold: &store.Money{Units: 900},
+	})
+	r.NoError(err)
+
+	f := func() *feed { return &feed{url: "testdata", currency: repo.DefaultCurrency} }
+
+	for _, csv := range []string{
+		"iPhone 12;999\n",
+		// crossing fires once
+		"iPhone 12;899\n",
+		"iPhone 12;850\n",
+		"iPhone 12;850\n",
+		// crossing again after rise
+		"iPhone 12;950\n",
+		"iPhone 12;899\n",
+	} {
+		_, err := s.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\n"+csv), f())
+		r.NoError(err)
+	}
+
+	resp, err := s.ListTriggeredAlerts(ctx, &store.ListTriggeredAlertsRequest{RuleId: rule.Rule.Id})
+	r.NoError(err)
+	r.Len(resp.Alerts, 2)
+
+	r.Equal("alice", resp.Alerts[0].Owner)
+	r.Equal(int64(899), resp.Alerts[0].Price.Units)
+	r.Equal(int64(999), resp.Alerts[0].OldPrice.Units)
+	r.Equal(int64(899), resp.Alerts[1].Price.Units)
+	r.Equal(int64(950), resp.Alerts[1].OldPrice.Units)
+
+	_, err = s.ListTriggeredAlerts(ctx, &store.ListTriggeredAlertsRequest{RuleId: "invalid"})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var errInvalidCurrency = errors.New("invalid currency code")
+
+// normalizeCurrency validates ISO 4217 alike code and returns it upper cased.
+// Empty value is resolved to fallback.
+func normalizeCurrency(code, fallback string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return fallback, nil
+	}
+
+	if len(code) != 3 {
+		return "", errInvalidCurrency
+	}
+
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", errInvalidCurrency
+		}
+	}
+
+	return code, nil
+}
+
+// convert returns price in target currency using the latest exchange rate
+// effective at given time. Inverse rate is used if direct one is missing.
+func (s *server) convert(ctx context.Context, price repo.Amount, from, to string, at time.Time) (repo.Amount, error) {
+	if from == to {
+		return price, nil
+	}
+
+	rate, err := s.repo.FindRate(ctx, from, to, at)
+	if err == nil {
+		return convertAmount(new(big.Rat).Mul(price.Rat(), new(big.Rat).SetFloat64(rate.Rate)))
+	}
+	if !errors.Is(err, repo.ErrNotFound) {
+		return repo.Amount{}, err
+	}
+
+	rate, err = s.repo.FindRate(ctx, to, from, at)
+	if err != nil {
+		return repo.Amount{}, err
+	}
+
+	return convertAmount(new(big.Rat).Quo(price.Rat(), new(big.Rat).SetFloat64(rate.Rate)))
+}
+
+// convertAmount rounds converted price to cents, it fails if the price is
+// out of range.
+func convertAmount(r *big.Rat) (repo.Amount, error) {
+	a, err := repo.AmountFromRat(r)
+	if err != nil {
+		return repo.Amount{}, err
+	}
+
+	return a.Round(2), nil
+}
+
+// newMoney converts amount to its protobuf representation.
+func newMoney(a repo.Amount, currency string) *pb.Money {
+	return &pb.Money{
+		Currency: currency,
+		Units:    a.Units(),
+		Nanos:    a.Nanos(),
+	}
+}
+
+// parseMoney converts protobuf money into amount and normalized currency.
+func parseMoney(m *pb.Money) (repo.Amount, string, error) {
+	amount, err := repo.NewAmount(m.Units, m.Nanos)
+	if err != nil {
+		return repo.Amount{}, "", err
+	}
+
+	currency, err := normalizeCurrency(m.Currency, "")
+	if err != nil {
+		return repo.Amount{}, "", err
+	}
+
+	return amount, currency, nil
+}
+
+func (s *server) SetRate(ctx context.Context, in *pb.SetRateRequest) (*pb.SetRateResponse, error) {
+	if in.Rate == nil || in.Rate.Rate <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "positive rate must be specified")
+	}
+
+	from, err := normalizeCurrency(in.Rate.From, "")
+	if err != nil || from == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid source currency")
+	}
+
+	to, err := normalizeCurrency(in.Rate.To, "")
+	if err != nil || to == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target currency")
+	}
+
+	effectiveAt := time.Now().UTC()
+	if in.Rate.EffectiveAt != nil {
+		effectiveAt = in.Rate.EffectiveAt.AsTime()
+	}
+
+	rate := &repo.Rate{
+		From:        from,
+		To:          to,
+		Rate:        in.Rate.Rate,
+		EffectiveAt: effectiveAt,
+	}
+
+	if err := s.repo.SaveRate(ctx, rate); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not save rate")
+	}
+
+	return &pb.SetRateResponse{}, nil
+}
+
+func (s *server) ListRates(ctx context.Context, in *pb.ListRatesRequest) (*pb.ListRatesResponse, error) {
+	rates, err := s.repo.ListRates(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve rates")
+	}
+
+	resp := &pb.ListRatesResponse{Rates: make([]*pb.Rate, 0, len(rates))}
+	for _, r := range rates {
+		resp.Rates = append(resp.Rates, &pb.Rate{
+			From:        r.From,
+			To:          r.To,
+			Rate:        r.Rate,
+			EffectiveAt: timestamppb.New(r.EffectiveAt),
+		})
+	}
+
+	return resp, nil
+}
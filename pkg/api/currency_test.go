@@ -0,0 +1,59 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Code     string
+		Fallback string
+		Expected string
+		Invalid  bool
+	}{
+		{
+			Name:     "Upper",
+			Code:     "EUR",
+			Expected: "EUR",
+		},
+		{
+			Name:     "Lower",
+			Code:     " kzt ",
+			Expected: "KZT",
+		},
+		{
+			Name:     "Fallback",
+			Code:     "",
+			Fallback: "USD",
+			Expected: "USD",
+		},
+		{
+			Name:    "Length",
+			Code:    "EURO",
+			Invalid: true,
+		},
+		{
+			Name:    "Symbols",
+			Code:    "U$D",
+			Invalid: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			code, err := normalizeCurrency(tc.Code, tc.Fallback)
+			if tc.Invalid {
+				r.Error(err)
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Expected, code)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *server) DeleteProduct(ctx context.Context, in *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	if in.Actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "actor must be specified")
+	}
+
+	err = s.repo.DeleteProduct(ctx, id, in.Actor, time.Now().UTC())
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not delete product")
+	}
+
+	return &pb.DeleteProductResponse{}, nil
+}
+
+func (s *server) RestoreProduct(ctx context.Context, in *pb.RestoreProductRequest) (*pb.RestoreProductResponse, error) {
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	err = s.repo.RestoreProduct(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "deleted product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not restore product")
+	}
+
+	return &pb.RestoreProductResponse{}, nil
+}
+
+func (s *server) PurgeProduct(ctx context.Context, in *pb.PurgeProductRequest) (*pb.PurgeProductResponse, error) {
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	err = s.repo.PurgeProduct(ctx, id, time.Now().UTC().Add(-s.retention))
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	if errors.Is(err, repo.ErrRetained) {
+		return nil, status.Errorf(codes.FailedPrecondition, "product must be deleted at least %s ago", s.retention)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not purge product")
+	}
+
+	return &pb.PurgeProductResponse{}, nil
+}
+
+func deletionTime(p *repo.Product) *timestamppb.Timestamp {
+	if p.DeletedAt == nil {
+		return nil
+	}
+	return newTimestamp(*p.DeletedAt)
+}
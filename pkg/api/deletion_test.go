@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerDeleteValidation(t *testing.T) {
+	var (
+		ctx = context.Background()
+		srv = &server{timeout: _defaultTimeout, retention: _defaultRetention}
+		id  = primitive.NewObjectID().Hex()
+	)
+
+	_, err := srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: "invalid", Actor: "admin"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: id})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.RestoreProduct(ctx, &store.RestoreProductRequest{Id: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.PurgeProduct(ctx, &store.PurgeProductRequest{Id: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerDeleteProduct(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:      repo.NewMongoRepo("productstore_test", conn),
+		timeout:   _defaultTimeout,
+		retention: time.Hour,
+		hclient:   &http.Client{},
+	}
+
+	for _, name := range []string{"iPhone 12", "Galaxy S20"} {
+		r.NoError(srv.repo.SaveProduct(ctx, repo.NewProduct(func(p *repo.Product) {
+			p.Name = name
+			p.Price = repo.MustParseAmount("899")
+			p.UpdatedAt = time.Now().UTC()
+		})))
+	}
+
+	prod, err := srv.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	id := prod.ID.Hex()
+
+	_, err = srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: id, Actor: "admin"})
+	r.NoError(err)
+
+	// deleting twice is not allowed
+	_, err = srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: id, Actor: "admin"})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	listReq := &store.ListRequest{Paging: &store.Paging{}}
+
+	result, err := srv.List(ctx, listReq)
+	r.NoError(err)
+	r.Equal([]string{"Galaxy S20"}, productNames(result.Products))
+	r.Equal(int64(1), result.TotalCount)
+
+	listReq.IncludeDeleted = true
+	result, err = srv.List(ctx, listReq)
+	r.NoError(err)
+	r.Len(result.Products, 2)
+	r.Equal(int64(2), result.TotalCount)
+	r.NotNil(result.Products[0].DeletedAt)
+	r.Nil(result.Products[1].DeletedAt)
+
+	details, err := srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Id{Id: id}})
+	r.NoError(err)
+	r.Equal("admin", details.Product.DeletedBy)
+	r.NotNil(details.Product.DeletedAt)
+
+	// retention period has not passed
+	_, err = srv.PurgeProduct(ctx, &store.PurgeProductRequest{Id: id})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_, err = srv.RestoreProduct(ctx, &store.RestoreProductRequest{Id: id})
+	r.NoError(err)
+
+	_, err = srv.RestoreProduct(ctx, &store.RestoreProductRequest{Id: id})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	// product which is not deleted can not be purged
+	srv.retention = 0
+	_, err = srv.PurgeProduct(ctx, &store.PurgeProductRequest{Id: id})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	_, err = srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: id, Actor: "admin"})
+	r.NoError(err)
+
+	_, err = srv.PurgeProduct(ctx, &store.PurgeProductRequest{Id: id})
+	r.NoError(err)
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Id{Id: id}})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	_, err = srv.PurgeProduct(ctx, &store.PurgeProductRequest{Id: id})
+	r.Equal(codes.NotFound, status.Code(err))
+}
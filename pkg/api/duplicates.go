@@ -0,0 +1,75 @@
+package api
+
+import (
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+)
+
+// feedRow is a product parsed from a single CSV record.
+type feedRow struct {
+	num  int32
+	prod *repo.Product
+}
+
+// resolveDuplicates picks one product among rows sharing the same name
+// according to the policy and reports the duplicates. Nil product means
+// all rows are rejected, nil report means there were no duplicates.
+//
+// Rows agreeing on price are never rejected. Prices in different currencies
+// can not be ordered, so such rows are rejected by price based policies.
+func resolveDuplicates(rows []*feedRow, policy pb.DuplicatePolicy) (*repo.Product, *pb.Duplicate) {
+	if len(rows) == 1 {
+		return rows[0].prod, nil
+	}
+
+	report := &pb.Duplicate{
+		Name:       rows[0].prod.Name,
+		Resolution: policy,
+	}
+
+	var (
+		same     = true
+		currency = rows[0].prod.Currency
+	)
+
+	for _, row := range rows {
+		report.Rows = append(report.Rows, row.num)
+		report.Prices = append(report.Prices, newMoney(row.prod.Price, row.prod.Currency))
+
+		if row.prod.Price.Cmp(rows[0].prod.Price) != 0 || row.prod.Currency != currency {
+			same = false
+		}
+	}
+
+	var chosen *repo.Product
+
+	switch {
+	case same:
+		chosen = rows[0].prod
+	case policy == pb.DuplicatePolicy_FIRST_WINS:
+		chosen = rows[0].prod
+	case policy == pb.DuplicatePolicy_LAST_WINS:
+		chosen = rows[len(rows)-1].prod
+	case policy == pb.DuplicatePolicy_LOWEST_PRICE, policy == pb.DuplicatePolicy_HIGHEST_PRICE:
+		chosen = rows[0].prod
+		for _, row := range rows[1:] {
+			if row.prod.Currency != currency {
+				chosen = nil
+				break
+			}
+
+			cmp := row.prod.Price.Cmp(chosen.Price)
+			if (policy == pb.DuplicatePolicy_LOWEST_PRICE && cmp < 0) || (policy == pb.DuplicatePolicy_HIGHEST_PRICE && cmp > 0) {
+				chosen = row.prod
+			}
+		}
+	default:
+		// REJECT_BOTH
+	}
+
+	if chosen != nil {
+		report.Chosen = newMoney(chosen.Price, chosen.Currency)
+	}
+
+	return chosen, report
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDuplicates(t *testing.T) {
+	row := func(num int32, price, currency string) *feedRow {
+		return &feedRow{
+			num: num,
+			prod: repo.NewProduct(func(p *repo.Product) {
+				p.Name = "iPhone 12"
+				p.Price = repo.MustParseAmount(price)
+				p.Currency = currency
+			}),
+		}
+	}
+
+	rows := func(prices ...string) []*feedRow {
+		var result []*feedRow
+		for i, price := range prices {
+			result = append(result, row(int32(i+1), price, "USD"))
+		}
+		return result
+	}
+
+	testCases := []struct {
+		Name     string
+		Rows     []*feedRow
+		Policy   pb.DuplicatePolicy
+		Expected string
+		Rejected bool
+		Reported bool
+	}{
+		{
+			Name:     "Single",
+			Rows:     rows("999"),
+			Policy:   pb.DuplicatePolicy_REJECT_BOTH,
+			Expected: "999",
+		},
+		{
+			Name:     "LastWins",
+			Rows:     rows("999", "899", "949"),
+			Policy:   pb.DuplicatePolicy_LAST_WINS,
+			Expected: "949",
+			Reported: true,
+		},
+		{
+			Name:     "FirstWins",
+			Rows:     rows("999", "899", "949"),
+			Policy:   pb.DuplicatePolicy_FIRST_WINS,
+			Expected: "999",
+			Reported: true,
+		},
+		{
+			Name:     "RejectBoth",
+			Rows:     rows("999", "899"),
+			Policy:   pb.DuplicatePolicy_REJECT_BOTH,
+			Rejected: true,
+			Reported: true,
+		},
+		{
+			Name:     "RejectSame",
+			Rows:     rows("999", "999.00"),
+			Policy:   pb.DuplicatePolicy_REJECT_BOTH,
+			Expected: "999",
+			Reported: true,
+		},
+		{
+			Name:     "LowestPrice",
+			Rows:     rows("999", "899", "949"),
+			Policy:   pb.DuplicatePolicy_LOWEST_PRICE,
+			Expected: "899",
+			Reported: true,
+		},
+		{
+			Name:     "HighestPrice",
+			Rows:     rows("999", "899", "1049.99"),
+			Policy:   pb.DuplicatePolicy_HIGHEST_PRICE,
+			Expected: "1049.99",
+			Reported: true,
+		},
+		{
+			Name:     "MixedCurrencies",
+			Rows:     append(rows("999"), row(2, "899", "EUR")),
+			Policy:   pb.DuplicatePolicy_LOWEST_PRICE,
+			Rejected: true,
+			Reported: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			prod, report := resolveDuplicates(tc.Rows, tc.Policy)
+
+			if tc.Rejected {
+				r.Nil(prod)
+			} else {
+				r.NotNil(prod)
+				r.Equal(tc.Expected, prod.Price.String())
+			}
+
+			if !tc.Reported {
+				r.Nil(report)
+				return
+			}
+
+			r.NotNil(report)
+			r.Equal("iPhone 12", report.Name)
+			r.Len(report.Rows, len(tc.Rows))
+			r.Len(report.Prices, len(tc.Rows))
+			r.Equal(tc.Policy, report.Resolution)
+			r.Equal(tc.Rejected, report.Chosen == nil)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// productFields maps top level fields of pb.Product to the stored fields
+// they are built from.
+var productFields = map[string][]string{
+	"name":                {"name"},
+	"price":               {"price", "currency"},
+	"num_of_changes":      {"num_of_changes", "changes"},
+	"last_update":         {"updated_at"},
+	"currency":            {"currency"},
+	"amount":              {"price", "currency"},
+	"last_change_percent": {"last_change_percent"},
+	"updated_at":          {"updated_at"},
+	"created_at":          {"created_at"},
+	"deleted_at":          {"deleted_at"},
+	"pinned":              {"pinned"},
+	"stale":               {"stale"},
+	"last_seen_at":        {"last_seen_at"},
+}
+
+// maskTree holds mask paths split by fields, nil subtree selects the whole
+// field.
+type maskTree map[string]maskTree
+
+func newMaskTree(paths []string) maskTree {
+	tree := maskTree{}
+	for _, path := range paths {
+		tree.add(strings.Split(path, "."))
+	}
+
+	return tree
+}
+
+func (t maskTree) add(names []string) {
+	sub, ok := t[names[0]]
+
+	switch {
+	case len(names) == 1:
+		t[names[0]] = nil
+	case ok && sub == nil:
+		// the whole field is already selected
+	default:
+		if !ok {
+			sub = maskTree{}
+			t[names[0]] = sub
+		}
+		sub.add(names[1:])
+	}
+}
+
+// validateMask checks that mask paths refer to fields of the message.
+func validateMask(mask *fieldmaskpb.FieldMask, m proto.Message) error {
+	if len(mask.GetPaths()) == 0 || mask.IsValid(m) {
+		return nil
+	}
+
+	return status.Errorf(codes.InvalidArgument, "invalid read mask %v", mask.GetPaths())
+}
+
+// applyMask clears fields of the message which are not selected by the
+// mask, empty mask keeps all of them.
+func applyMask(m proto.Message, mask *fieldmaskpb.FieldMask) {
+	if len(mask.GetPaths()) == 0 {
+		return
+	}
+
+	pruneMessage(m.ProtoReflect(), newMaskTree(mask.GetPaths()))
+}
+
+func pruneMessage(m protoreflect.Message, tree maskTree) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		sub, ok := tree[string(fd.Name())]
+		switch {
+		case !ok:
+			m.Clear(fd)
+		case sub != nil && fd.Message() != nil && !fd.IsList() && !fd.IsMap():
+			pruneMessage(v.Message(), sub)
+		}
+		return true
+	})
+}
+
+// maskSelects tells whether any of top level fields is selected by the
+// mask, empty mask selects all of them.
+func maskSelects(mask *fieldmaskpb.FieldMask, names ...string) bool {
+	if len(mask.GetPaths()) == 0 {
+		return true
+	}
+
+	tree := newMaskTree(mask.GetPaths())
+	for _, name := range names {
+		if _, ok := tree[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// productProjection returns stored fields needed to build products with
+// fields selected by the mask, it is empty if all fields are needed.
+func productProjection(mask *fieldmaskpb.FieldMask) []string {
+	var (
+		fields []string
+		seen   = make(map[string]bool)
+	)
+
+	for _, path := range mask.GetPaths() {
+		name := strings.SplitN(path, ".", 2)[0]
+		for _, f := range productFields[name] {
+			if !seen[f] {
+				seen[f] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMaskTree(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(maskTree{"name": nil, "price": maskTree{"units": nil}}, newMaskTree([]string{"name", "price.units"}))
+	r.Equal(maskTree{"price": nil}, newMaskTree([]string{"price", "price.units"}))
+	r.Equal(maskTree{"price": nil}, newMaskTree([]string{"price.units", "price"}))
+}
+
+func TestApplyMask(t *testing.T) {
+	r := require.New(t)
+
+	newProduct := func() *store.Product {
+		return &store.Product{
+			Name:         "Apple iPhone 12",
+			Price:        899,
+			NumOfChanges: 2,
+			LastUpdate:   "2020-11-01",
+			Currency:     "USD",
+			Amount:       &store.Money{Currency: "USD", Units: 899},
+		}
+	}
+
+	prod := newProduct()
+	applyMask(prod, nil)
+	r.Equal(newProduct().String(), prod.String())
+
+	prod = newProduct()
+	applyMask(prod, &fieldmaskpb.FieldMask{Paths: []string{"name", "amount.units"}})
+	r.Equal("Apple iPhone 12", prod.Name)
+	r.Zero(prod.Price)
+	r.Zero(prod.NumOfChanges)
+	r.Empty(prod.LastUpdate)
+	r.Empty(prod.Currency)
+	r.Equal(int64(899), prod.Amount.Units)
+	r.Empty(prod.Amount.Currency)
+
+	details := &store.ProductDetails{
+		Id:        "5fa1",
+		Name:      "Apple iPhone 12",
+		Price:     &store.Money{Currency: "USD", Units: 899},
+		CreatedAt: timestamppb.Now(),
+		History:   &store.HistorySummary{NumOfChanges: 2},
+	}
+	applyMask(details, &fieldmaskpb.FieldMask{Paths: []string{"id", "history"}})
+	r.Equal("5fa1", details.Id)
+	r.Empty(details.Name)
+	r.Nil(details.Price)
+	r.Nil(details.CreatedAt)
+	r.Equal(int64(2), details.History.NumOfChanges)
+}
+
+func TestValidateMask(t *testing.T) {
+	r := require.New(t)
+
+	r.NoError(validateMask(nil, &store.Product{}))
+	r.NoError(validateMask(&fieldmaskpb.FieldMask{Paths: []string{"name", "amount.units"}}, &store.Product{}))
+
+	err := validateMask(&fieldmaskpb.FieldMask{Paths: []string{"sku"}}, &store.Product{})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	err = validateMask(&fieldmaskpb.FieldMask{Paths: []string{"name.first"}}, &store.Product{})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestMaskSelects(t *testing.T) {
+	r := require.New(t)
+
+	r.True(maskSelects(nil, "price"))
+	r.True(maskSelects(&fieldmaskpb.FieldMask{Paths: []string{"name", "amount.units"}}, "price", "amount"))
+	r.False(maskSelects(&fieldmaskpb.FieldMask{Paths: []string{"name", "currency"}}, "price", "amount"))
+}
+
+func TestProductProjection(t *testing.T) {
+	r := require.New(t)
+
+	r.Empty(productProjection(nil))
+	r.Equal([]string{"name", "price", "currency"}, productProjection(&fieldmaskpb.FieldMask{Paths: []string{"name", "amount.units", "currency"}}))
+	r.Equal([]string{"num_of_changes", "changes", "updated_at"}, productProjection(&fieldmaskpb.FieldMask{Paths: []string{"num_of_changes", "last_update"}}))
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const _maxMovers = 100
+
+func (s *server) TopMovers(ctx context.Context, in *pb.TopMoversRequest) (*pb.TopMoversResponse, error) {
+	agg, ok := s.repo.(repo.Aggregator)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "statistics are not supported by repository")
+	}
+
+	opts, err := buildMoversOptions(in, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	movers, err := agg.TopMovers(ctx, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not rank products")
+	}
+
+	resp := &pb.TopMoversResponse{
+		Since:  timestamppb.New(opts.Since),
+		Until:  timestamppb.New(opts.Until),
+		Movers: make([]*pb.Mover, 0, len(movers)),
+	}
+
+	for i := range movers {
+		m := &movers[i]
+
+		resp.Movers = append(resp.Movers, &pb.Mover{
+			Product:       newProduct(&m.Product, m.Product.Price, m.Product.PriceCurrency()),
+			FromPrice:     newMoney(m.From, m.Currency),
+			ToPrice:       newMoney(m.To, m.Currency),
+			Change:        newMoney(m.Change, m.Currency),
+			ChangePercent: m.ChangePercent,
+		})
+	}
+
+	return resp, nil
+}
+
+func buildMoversOptions(in *pb.TopMoversRequest, now time.Time) (*repo.MoversOptions, error) {
+	opts := &repo.MoversOptions{
+		Since: now.Add(-_defaultStatsWindow),
+		Until: now,
+		Limit: in.Limit,
+	}
+
+	if in.Until != nil {
+		opts.Until = in.Until.AsTime()
+	}
+	if in.Since != nil {
+		opts.Since = in.Since.AsTime()
+	} else if in.Until != nil {
+		opts.Since = opts.Until.Add(-_defaultStatsWindow)
+	}
+
+	if opts.Until.Before(opts.Since) {
+		return nil, status.Errorf(codes.InvalidArgument, "window must not end before it starts")
+	}
+
+	if in.Limit < 0 || in.Limit > _maxMovers {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be in range of 0..%d", _maxMovers)
+	}
+
+	if in.Direction == pb.MoveDirection_DECREASE {
+		opts.Direction = repo.MoveDecrease
+	}
+	if in.Measure == pb.MoveMeasure_PERCENT {
+		opts.Measure = repo.MovePercent
+	}
+
+	if in.Filter != nil {
+		filter, err := buildFilter(in.Filter)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Filter = filter
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBuildMoversOptions(t *testing.T) {
+	var (
+		now  = time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)
+		week = now.Add(-7 * 24 * time.Hour)
+	)
+
+	testCases := []struct {
+		Name    string
+		Request *store.TopMoversRequest
+		Code    codes.Code
+		Since   time.Time
+		Until   time.Time
+	}{
+		{
+			Name:    "Default",
+			Request: &store.TopMoversRequest{},
+			Since:   now.Add(-24 * time.Hour),
+			Until:   now,
+		},
+		{
+			Name:    "Since",
+			Request: &store.TopMoversRequest{Since: timestamppb.New(week)},
+			Since:   week,
+			Until:   now,
+		},
+		{
+			Name:    "Until",
+			Request: &store.TopMoversRequest{Until: timestamppb.New(week)},
+			Since:   week.Add(-24 * time.Hour),
+			Until:   week,
+		},
+		{
+			Name:    "InvalidWindow",
+			Request: &store.TopMoversRequest{Since: timestamppb.New(now), Until: timestamppb.New(week)},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "NegativeLimit",
+			Request: &store.TopMoversRequest{Limit: -1},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "LargeLimit",
+			Request: &store.TopMoversRequest{Limit: _maxMovers + 1},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "InvalidFilter",
+			Request: &store.TopMoversRequest{Filter: &store.Filter{NameRegex: "("}},
+			Code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			opts, err := buildMoversOptions(tc.Request, now)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Since, opts.Since)
+			r.Equal(tc.Until, opts.Until)
+		})
+	}
+
+	opts, err := buildMoversOptions(&store.TopMoversRequest{
+		Direction: store.MoveDirection_DECREASE,
+		Measure:   store.MoveMeasure_PERCENT,
+		Filter:    &store.Filter{NamePrefix: "Apple"},
+		Limit:     5,
+	}, now)
+	require.NoError(t, err)
+	require.Equal(t, repo.MoveDecrease, opts.Direction)
+	require.Equal(t, repo.MovePercent, opts.Measure)
+	require.Equal(t, "Apple", opts.Filter.NamePrefix)
+	require.Equal(t, int64(5), opts.Limit)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) UpdatePrice(ctx context.Context, in *pb.UpdatePriceRequest) (*pb.UpdatePriceResponse, error) {
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	if in.Actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "actor must be specified")
+	}
+
+	old, err := s.repo.FindByID(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve product")
+	}
+
+	// soft deleted products are hidden until restored
+	if old.DeletedAt != nil {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+
+	price, currency, err := s.parseManualPrice(in.Price, old.PriceCurrency())
+	if err != nil {
+		return nil, err
+	}
+
+	prod := &repo.Product{
+		ID:        old.ID,
+		Name:      old.Name,
+		Price:     price,
+		Currency:  currency,
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	details, err := s.saveManually(ctx, prod, in.Actor, in.Reason, in.Pin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdatePriceResponse{Product: details}, nil
+}
+
+func (s *server) UpsertProduct(ctx context.Context, in *pb.UpsertProductRequest) (*pb.UpsertProductResponse, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be specified")
+	}
+
+	if in.Actor == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "actor must be specified")
+	}
+
+	old, err := s.repo.FindByName(ctx, name)
+	if errors.Is(err, repo.ErrNotFound) {
+		old = nil
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve product")
+	}
+
+	if old != nil && old.DeletedAt != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "product is deleted, it must be restored first")
+	}
+
+	currency := repo.DefaultCurrency
+	if old != nil {
+		currency = old.PriceCurrency()
+	}
+
+	price, currency, err := s.parseManualPrice(in.Price, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	prod := repo.NewProduct(func(p *repo.Product) {
+		p.Name = name
+		p.SKU = strings.TrimSpace(in.Sku)
+		p.Price = price
+		p.Currency = currency
+		p.UpdatedAt = time.Now().UTC()
+	})
+
+	details, err := s.saveManually(ctx, prod, in.Actor, in.Reason, in.Pin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpsertProductResponse{Product: details, Created: old == nil}, nil
+}
+
+// parseManualPrice validates price set manually, validation rules except
+// the sign check are not applied to it.
+func (s *server) parseManualPrice(m *pb.Money, fallback string) (repo.Amount, string, error) {
+	if m == nil {
+		return repo.Amount{}, "", status.Errorf(codes.InvalidArgument, "price must be specified")
+	}
+
+	price, currency, err := parseMoney(m)
+	if err != nil {
+		return repo.Amount{}, "", status.Errorf(codes.InvalidArgument, "invalid price: %v", err)
+	}
+
+	if !s.rules.AllowNonPositive && price.Sign() <= 0 {
+		return repo.Amount{}, "", status.Errorf(codes.InvalidArgument, "price must be positive")
+	}
+
+	if currency == "" {
+		currency = fallback
+	}
+
+	return price, currency, nil
+}
+
+// saveManually saves product overriding pinned price and returns its
+// details as stored. Alert rules are evaluated against the new price the
+// same way as for imports.
+func (s *server) saveManually(ctx context.Context, prod *repo.Product, actor, reason string, pin pb.PinUpdate) (*pb.ProductDetails, error) {
+	opts := []repo.SaveOption{repo.WithAudit(actor, reason), repo.Override()}
+
+	switch pin {
+	case pb.PinUpdate_PIN:
+		opts = append(opts, repo.Pin(true))
+	case pb.PinUpdate_UNPIN:
+		opts = append(opts, repo.Pin(false))
+	}
+
+	if err := s.repo.SaveProduct(ctx, prod, opts...); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not save product")
+	}
+
+	rules, err := s.alertRules(ctx)
+	if err == nil {
+		err = s.evaluateAlerts(ctx, rules, prod.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not evaluate alerts")
+	}
+
+	saved, err := s.repo.FindByName(ctx, prod.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve product")
+	}
+
+	return newProductDetails(saved), nil
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseManualPrice(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Money    *store.Money
+		Currency string
+		Code     codes.Code
+	}{
+		{
+			Name:     "Valid",
+			Money:    &store.Money{Currency: "eur", Units: 10},
+			Currency: "EUR",
+		},
+		{
+			Name:     "Fallback",
+			Money:    &store.Money{Units: 10},
+			Currency: "KZT",
+		},
+		{
+			Name: "Missing",
+			Code: codes.InvalidArgument,
+		},
+		{
+			Name:  "Invalid",
+			Money: &store.Money{Units: 10, Nanos: -1},
+			Code:  codes.InvalidArgument,
+		},
+		{
+			Name:  "NonPositive",
+			Money: &store.Money{},
+			Code:  codes.InvalidArgument,
+		},
+	}
+
+	srv := &server{}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			_, currency, err := srv.parseManualPrice(tc.Money, "KZT")
+			r.Equal(tc.Code, status.Code(err))
+			r.Equal(tc.Currency, currency)
+		})
+	}
+}
+
+func TestServerUpdatePrice(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	f := &feed{url: "testdata", currency: repo.DefaultCurrency}
+
+	upserted, err := srv.UpsertProduct(ctx, &store.UpsertProductRequest{
+		Name:  "iPhone 12",
+		Sku:   "APL-12",
+		Price: &store.Money{Units: 899},
+		Actor: "admin",
+		Pin:   store.PinUpdate_PIN,
+	})
+	r.NoError(err)
+	r.True(upserted.Created)
+	r.True(upserted.Product.Pinned)
+	r.Equal("USD", upserted.Product.Price.Currency)
+
+	// imports do not overwrite pinned price
+	result, err := srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\n"), f)
+	r.NoError(err)
+	r.Equal(int32(1), result.pinned)
+	r.Equal(int32(0), result.updated)
+
+	prod, err := srv.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("899", prod.Price.String())
+
+	// manual changes are applied and audited
+	updated, err := srv.UpdatePrice(ctx, &store.UpdatePriceRequest{
+		Id:     upserted.Product.Id,
+		Price:  &store.Money{Units: 849, Nanos: 990000000},
+		Actor:  "admin",
+		Reason: "black friday",
+	})
+	r.NoError(err)
+	r.True(updated.Product.Pinned)
+	r.Equal(int64(849), updated.Product.Price.Units)
+	r.Equal(int64(1), updated.Product.History.NumOfChanges)
+	r.Equal("admin", updated.Product.History.LastChangedBy)
+	r.Equal("black friday", updated.Product.History.LastChangeReason)
+	r.NotNil(updated.Product.History.LastChangedAt)
+
+	upserted, err = srv.UpsertProduct(ctx, &store.UpsertProductRequest{
+		Name:  "iPhone 12",
+		Price: &store.Money{Units: 849, Nanos: 990000000},
+		Actor: "admin",
+		Pin:   store.PinUpdate_UNPIN,
+	})
+	r.NoError(err)
+	r.False(upserted.Created)
+	r.False(upserted.Product.Pinned)
+	r.Equal("APL-12", upserted.Product.Sku)
+
+	result, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\n"), f)
+	r.NoError(err)
+	r.Equal(int32(0), result.pinned)
+	r.Equal(int32(1), result.updated)
+
+	prod, err = srv.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("999", prod.Price.String())
+	r.Equal(_importActor, prod.Changes[1].Actor)
+	r.Equal("testdata", prod.Changes[1].Reason)
+
+	_, err = srv.UpdatePrice(ctx, &store.UpdatePriceRequest{Id: upserted.Product.Id, Price: &store.Money{Units: 1}})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.UpdatePrice(ctx, &store.UpdatePriceRequest{Id: "invalid", Actor: "admin"})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.UpsertProduct(ctx, &store.UpsertProductRequest{Name: " ", Actor: "admin"})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	// deleted products are not repriced until restored
+	_, err = srv.DeleteProduct(ctx, &store.DeleteProductRequest{Id: upserted.Product.Id, Actor: "admin"})
+	r.NoError(err)
+
+	_, err = srv.UpdatePrice(ctx, &store.UpdatePriceRequest{Id: upserted.Product.Id, Price: &store.Money{Units: 1}, Actor: "admin"})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	_, err = srv.UpsertProduct(ctx, &store.UpsertProductRequest{Name: "iPhone 12", Price: &store.Money{Units: 1}, Actor: "admin"})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	prod, err = srv.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("999", prod.Price.String())
+}
+
+func TestServerUpdatePriceAlerts(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	rule, err := srv.CreateAlertRule(ctx, &store.CreateAlertRuleRequest{
+		Owner:     "alice",
+		Name:      "iPhone 12",
+		Kind:      store.AlertKind_BELOW,
+		Threshold: &store.Money{Units: 900},
+	})
+	r.NoError(err)
+
+	upserted, err := srv.UpsertProduct(ctx, &store.UpsertProductRequest{
+		Name:  "iPhone 12",
+		Price: &store.Money{Units: 999},
+		Actor: "admin",
+	})
+	r.NoError(err)
+
+	_, err = srv.UpdatePrice(ctx, &store.UpdatePriceRequest{
+		Id:    upserted.Product.Id,
+		Price: &store.Money{Units: 849},
+		Actor: "admin",
+	})
+	r.NoError(err)
+
+	resp, err := srv.ListTriggeredAlerts(ctx, &store.ListTriggeredAlertsRequest{RuleId: rule.Rule.Id})
+	r.NoError(err)
+	r.Len(resp.Alerts, 1)
+	r.Equal(int64(849), resp.Alerts[0].Price.Units)
+	r.Equal(int64(999), resp.Alerts[0].OldPrice.Units)
+}
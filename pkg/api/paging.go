@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/base64"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// _defaultLimit matches the page size used by repository when limit is unset.
+const _defaultLimit = 10
+
+// cursor is a position in the list bound to the sorting it was taken with.
+// Cursors and page tokens are encoded as BSON to keep types of sorting values.
+type cursor struct {
+	Sorting     []repo.SortKey `bson:"s"`
+	repo.Cursor `bson:",inline"`
+}
+
+func (c *cursor) matches(opts *repo.ListOptions) bool {
+	keys := opts.SortKeys()
+	if len(c.Sorting) != len(keys) {
+		return false
+	}
+
+	for i := range keys {
+		if c.Sorting[i] != keys[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pageToken is an opaque position of the page. Zero page number means the
+// position is unknown, e.g. when listing was started from raw last_id.
+type pageToken struct {
+	LastID   primitive.ObjectID `bson:"l,omitempty"`
+	Cursor   *cursor            `bson:"c,omitempty"`
+	Backward bool               `bson:"b,omitempty"`
+	Page     int64              `bson:"p,omitempty"`
+}
+
+func encodeToken(v interface{}) string {
+	data, _ := bson.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeToken(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, v)
+}
+
+func newCursor(opts *repo.ListOptions, p *repo.Product) *cursor {
+	return &cursor{
+		Sorting: opts.SortKeys(),
+		Cursor:  *opts.CursorOf(p),
+	}
+}
+
+func decodeCursor(s string, opts *repo.ListOptions) (*cursor, error) {
+	var c cursor
+	if err := decodeToken(s, &c); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid cursor")
+	}
+
+	if !c.matches(opts) {
+		return nil, status.Errorf(codes.InvalidArgument, "cursor does not match sorting")
+	}
+
+	return &c, nil
+}
+
+func decodePageToken(s string, opts *repo.ListOptions) (*pageToken, error) {
+	var t pageToken
+	if err := decodeToken(s, &t); err != nil || t.Page < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid page token")
+	}
+
+	if t.Cursor != nil && !t.Cursor.matches(opts) {
+		return nil, status.Errorf(codes.InvalidArgument, "page token does not match sorting")
+	}
+
+	return &t, nil
+}
+
+// currentPage resolves position of requested page from paging parameters.
+func currentPage(in *pb.Paging, opts *repo.ListOptions) (*pageToken, error) {
+	if in.PageToken != "" {
+		return decodePageToken(in.PageToken, opts)
+	}
+
+	positions := 0
+	for _, set := range []bool{in.After != "", in.Before != "", in.LastPage} {
+		if set {
+			positions++
+		}
+	}
+	if positions > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "only one of after, before and last page can be specified")
+	}
+
+	switch {
+	case in.After != "":
+		c, err := decodeCursor(in.After, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pageToken{Cursor: c}, nil
+	case in.Before != "":
+		c, err := decodeCursor(in.Before, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pageToken{Cursor: c, Backward: true}, nil
+	case in.LastPage:
+		return &pageToken{Backward: true}, nil
+	case in.LastId != "":
+		id, err := primitive.ObjectIDFromHex(in.LastId)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+		}
+
+		return &pageToken{LastID: id}, nil
+	default:
+		return &pageToken{Page: 1}, nil
+	}
+}
+
+func (t *pageToken) pager(limit int64) *repo.Pager {
+	p := &repo.Pager{LastID: t.LastID, Backward: t.Backward, Limit: limit}
+	if t.Cursor != nil {
+		p.Cursor = &t.Cursor.Cursor
+	}
+
+	return p
+}
+
+// fill sets boundary cursors and tokens of adjacent pages. Products are
+// expected to be read with one extra product which tells whether there are
+// more of them in the reading direction, it is trimmed from the result.
+func (t *pageToken) fill(resp *pb.ListResponse, opts *repo.ListOptions, products []repo.Product, limit int64) []repo.Product {
+	extra := int64(len(products)) > limit
+
+	var hasNext, hasPrev bool
+	if t.Backward {
+		if extra {
+			products = products[1:]
+		}
+		hasNext, hasPrev = t.Cursor != nil, extra
+
+		// the last page holds the remainder, so that pages are numbered the
+		// same way in both directions
+		if rem := resp.TotalCount % limit; t.Cursor == nil && rem > 0 && int64(len(products)) > rem {
+			products = products[int64(len(products))-rem:]
+			hasPrev = true
+		}
+	} else {
+		if extra {
+			products = products[:limit]
+		}
+		hasNext, hasPrev = extra, t.Cursor != nil || !t.LastID.IsZero()
+	}
+
+	page := t.Page
+	switch {
+	case !hasPrev:
+		page = 1
+	case t.Cursor == nil && t.Backward && resp.TotalCount > 0:
+		// last page number is known from total count
+		page = (resp.TotalCount + limit - 1) / limit
+	}
+
+	resp.HasMore = hasNext
+	resp.Page = page
+
+	if len(products) == 0 {
+		return products
+	}
+
+	var (
+		start = newCursor(opts, &products[0])
+		end   = newCursor(opts, &products[len(products)-1])
+	)
+
+	resp.LastId = products[len(products)-1].ID.Hex()
+	resp.StartCursor = encodeToken(start)
+	resp.EndCursor = encodeToken(end)
+
+	if hasNext {
+		next := &pageToken{Cursor: end}
+		if page > 0 {
+			next.Page = page + 1
+		}
+		resp.NextPageToken = encodeToken(next)
+	}
+
+	if hasPrev {
+		prev := &pageToken{Cursor: start, Backward: true}
+		if page > 1 {
+			prev.Page = page - 1
+		}
+		resp.PrevPageToken = encodeToken(prev)
+	}
+
+	return products
+}
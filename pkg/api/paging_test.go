@@ -0,0 +1,239 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testProducts(n int) []repo.Product {
+	products := make([]repo.Product, n)
+	for i := range products {
+		products[i] = repo.Product{
+			ID:    primitive.NewObjectID(),
+			Name:  string(rune('A' + i)),
+			Price: repo.MustParseAmount(strconv.Itoa(i + 1)),
+		}
+	}
+	return products
+}
+
+func TestCursor(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		opts = &repo.ListOptions{Sorting: repo.SortByPrice, Direction: repo.Asc}
+		p    = &repo.Product{ID: primitive.NewObjectID(), Price: repo.MustParseAmount("10.5")}
+	)
+
+	c, err := decodeCursor(encodeToken(newCursor(opts, p)), opts)
+	r.NoError(err)
+	r.Equal(p.ID, c.ID)
+	r.Len(c.Values, 1)
+	r.Equal("10.5", c.Values[0].(primitive.Decimal128).String())
+
+	_, err = decodeCursor(encodeToken(newCursor(opts, p)), &repo.ListOptions{Sorting: repo.SortByPrice})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	// all sorting keys are encoded
+	opts.ThenBy = []repo.SortKey{{Sorting: repo.SortByName, Direction: repo.Asc}}
+	p.Name = "Apple"
+
+	c, err = decodeCursor(encodeToken(newCursor(opts, p)), opts)
+	r.NoError(err)
+	r.Len(c.Values, 2)
+	r.Equal("Apple", c.Values[1])
+
+	_, err = decodeCursor(encodeToken(newCursor(opts, p)), &repo.ListOptions{Sorting: repo.SortByPrice, Direction: repo.Asc})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = decodeCursor("???", opts)
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestCurrentPage(t *testing.T) {
+	var (
+		opts   = &repo.ListOptions{Sorting: repo.SortByName}
+		id     = primitive.NewObjectID()
+		cursor = encodeToken(newCursor(opts, &repo.Product{ID: id, Name: "A"}))
+	)
+
+	testCases := []struct {
+		Name     string
+		Paging   *store.Paging
+		Expected *repo.Pager
+		Page     int64
+		Code     codes.Code
+	}{
+		{
+			Name:     "First",
+			Paging:   &store.Paging{},
+			Expected: &repo.Pager{Limit: 10},
+			Page:     1,
+		},
+		{
+			Name:     "LastID",
+			Paging:   &store.Paging{LastId: id.Hex()},
+			Expected: &repo.Pager{LastID: id, Limit: 10},
+		},
+		{
+			Name:     "After",
+			Paging:   &store.Paging{After: cursor},
+			Expected: &repo.Pager{Cursor: &repo.Cursor{Values: []interface{}{"A"}, ID: id}, Limit: 10},
+		},
+		{
+			Name:     "Before",
+			Paging:   &store.Paging{Before: cursor},
+			Expected: &repo.Pager{Cursor: &repo.Cursor{Values: []interface{}{"A"}, ID: id}, Backward: true, Limit: 10},
+		},
+		{
+			Name:     "LastPage",
+			Paging:   &store.Paging{LastPage: true},
+			Expected: &repo.Pager{Backward: true, Limit: 10},
+		},
+		{
+			Name:   "AfterAndBefore",
+			Paging: &store.Paging{After: cursor, Before: cursor},
+			Code:   codes.InvalidArgument,
+		},
+		{
+			Name:   "InvalidLastID",
+			Paging: &store.Paging{LastId: "invalid"},
+			Code:   codes.InvalidArgument,
+		},
+		{
+			Name:   "InvalidPageToken",
+			Paging: &store.Paging{PageToken: "???"},
+			Code:   codes.InvalidArgument,
+		},
+		{
+			Name:   "NegativePage",
+			Paging: &store.Paging{PageToken: encodeToken(&pageToken{Page: -1})},
+			Code:   codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			page, err := currentPage(tc.Paging, opts)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Expected, page.pager(10))
+			r.Equal(tc.Page, page.Page)
+		})
+	}
+}
+
+func TestPageTokenFill(t *testing.T) {
+	opts := &repo.ListOptions{Sorting: repo.SortByName, Direction: repo.Asc}
+
+	t.Run("Forward", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			products = testProducts(3)
+			resp     = &store.ListResponse{}
+			page     = &pageToken{Page: 1}
+		)
+
+		trimmed := page.fill(resp, opts, products, 2)
+		r.Equal(products[:2], trimmed)
+		r.True(resp.HasMore)
+		r.Equal(int64(1), resp.Page)
+		r.Empty(resp.PrevPageToken)
+		r.Equal(products[1].ID.Hex(), resp.LastId)
+
+		next, err := decodePageToken(resp.NextPageToken, opts)
+		r.NoError(err)
+		r.Equal(int64(2), next.Page)
+		r.False(next.Backward)
+		r.Equal(products[1].ID, next.Cursor.ID)
+
+		end, err := decodeCursor(resp.EndCursor, opts)
+		r.NoError(err)
+		r.Equal(next.Cursor, end)
+
+		// second page is the last one
+		resp = &store.ListResponse{}
+		r.Len(next.fill(resp, opts, products[2:], 2), 1)
+		r.False(resp.HasMore)
+		r.Empty(resp.NextPageToken)
+		r.Equal(int64(2), resp.Page)
+
+		prev, err := decodePageToken(resp.PrevPageToken, opts)
+		r.NoError(err)
+		r.Equal(int64(1), prev.Page)
+		r.True(prev.Backward)
+		r.Equal(products[2].ID, prev.Cursor.ID)
+	})
+
+	t.Run("Backward", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			products = testProducts(5)
+			resp     = &store.ListResponse{TotalCount: 5}
+			page     = &pageToken{Backward: true}
+		)
+
+		// the last page holds the remainder as when paging forward
+		trimmed := page.fill(resp, opts, products[2:], 2)
+		r.Equal(products[4:], trimmed)
+		r.False(resp.HasMore)
+		r.Empty(resp.NextPageToken)
+		r.Equal(int64(3), resp.Page)
+
+		prev, err := decodePageToken(resp.PrevPageToken, opts)
+		r.NoError(err)
+		r.Equal(int64(2), prev.Page)
+		r.Equal(products[4].ID, prev.Cursor.ID)
+
+		// extra product precedes the page
+		resp = &store.ListResponse{TotalCount: 5}
+		r.Equal(products[2:4], prev.fill(resp, opts, products[1:4], 2))
+		r.True(resp.HasMore)
+		r.Equal(int64(2), resp.Page)
+
+		prev, err = decodePageToken(resp.PrevPageToken, opts)
+		r.NoError(err)
+		r.Equal(int64(1), prev.Page)
+		r.Equal(products[2].ID, prev.Cursor.ID)
+
+		// beginning of the list is reached
+		resp = &store.ListResponse{TotalCount: 5}
+		r.Equal(products[:2], prev.fill(resp, opts, products[:2], 2))
+		r.True(resp.HasMore)
+		r.Equal(int64(1), resp.Page)
+		r.Empty(resp.PrevPageToken)
+		r.NotEmpty(resp.NextPageToken)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		r := require.New(t)
+
+		var (
+			resp = &store.ListResponse{}
+			page = &pageToken{LastID: primitive.NewObjectID()}
+		)
+
+		page.fill(resp, opts, testProducts(3), 2)
+		r.Equal(int64(0), resp.Page)
+		r.NotEmpty(resp.PrevPageToken)
+
+		next, err := decodePageToken(resp.NextPageToken, opts)
+		r.NoError(err)
+		r.Equal(int64(0), next.Page)
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *server) GetProduct(ctx context.Context, in *pb.GetProductRequest) (*pb.GetProductResponse, error) {
+	var (
+		prod *repo.Product
+		err  error
+	)
+
+	if err := validateMask(in.ReadMask, &pb.ProductDetails{}); err != nil {
+		return nil, err
+	}
+
+	switch key := in.Key.(type) {
+	case *pb.GetProductRequest_Id:
+		id, perr := primitive.ObjectIDFromHex(key.Id)
+		if perr != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+		}
+		prod, err = s.repo.FindByID(ctx, id)
+	case *pb.GetProductRequest_Name:
+		prod, err = s.repo.FindByName(ctx, key.Name)
+	case *pb.GetProductRequest_Sku:
+		if key.Sku == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "sku must not be empty")
+		}
+		prod, err = s.repo.FindBySKU(ctx, key.Sku)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "id, name or sku must be specified")
+	}
+
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve product")
+	}
+
+	if in.AsOf != nil {
+		prod, err = prod.AsOf(in.AsOf.AsTime())
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "product did not exist at the time")
+		}
+		if errors.Is(err, repo.ErrHistoryIncomplete) {
+			return nil, status.Errorf(codes.FailedPrecondition, "price history at the time is incomplete")
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not reconstruct product")
+		}
+	}
+
+	details := newProductDetails(prod)
+	applyMask(details, in.ReadMask)
+
+	return &pb.GetProductResponse{Product: details}, nil
+}
+
+func newProductDetails(p *repo.Product) *pb.ProductDetails {
+	return &pb.ProductDetails{
+		Id:        p.ID.Hex(),
+		Name:      p.Name,
+		Sku:       p.SKU,
+		Price:     newMoney(p.Price, p.PriceCurrency()),
+		CreatedAt: newTimestamp(p.CreatedAt),
+		UpdatedAt: newTimestamp(p.UpdatedAt),
+		History:   summarizeHistory(p),
+		DeletedAt: deletionTime(p),
+		DeletedBy: p.DeletedBy,
+		Pinned:    p.Pinned,
+	}
+}
+
+func summarizeHistory(p *repo.Product) *pb.HistorySummary {
+	summary := &pb.HistorySummary{NumOfChanges: int64(len(p.Changes))}
+
+	if len(p.Changes) > 0 {
+		last := p.Changes[len(p.Changes)-1]
+		summary.PreviousPrice = newMoney(last.Price, last.PriceCurrency())
+		summary.LastChangedAt = newTimestamp(last.ChangedAt)
+		summary.LastChangedBy = last.Actor
+		summary.LastChangeReason = last.Reason
+	}
+
+	var (
+		currency = p.PriceCurrency()
+		min, max = p.Price, p.Price
+	)
+
+	for _, c := range p.Changes {
+		if c.PriceCurrency() != currency {
+			continue
+		}
+
+		if c.Price.Cmp(min) < 0 {
+			min = c.Price
+		}
+		if c.Price.Cmp(max) > 0 {
+			max = c.Price
+		}
+	}
+
+	summary.MinPrice = newMoney(min, currency)
+	summary.MaxPrice = newMoney(max, currency)
+
+	return summary
+}
+
+// newTimestamp returns nil for unknown time instead of the Unix epoch.
+func newTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func (s *server) Search(ctx context.Context, in *pb.SearchRequest) (*pb.SearchResponse, error) {
+	if strings.TrimSpace(in.Query) == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "query must be specified")
+	}
+	if in.Offset < 0 || in.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "offset and limit must not be negative")
+	}
+
+	results, err := repo.Search(ctx, s.repo, &repo.SearchOptions{
+		Query:  in.Query,
+		Offset: in.Offset,
+		Limit:  in.Limit,
+	})
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not search products")
+	}
+
+	resp := &pb.SearchResponse{Results: make([]*pb.SearchResult, 0, len(results))}
+	for i := range results {
+		resp.Results = append(resp.Results, &pb.SearchResult{
+			Product: newProductDetails(&results[i].Product),
+			Score:   results[i].Score,
+		})
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSummarizeHistory(t *testing.T) {
+	r := require.New(t)
+
+	prod := repo.NewProduct(func(p *repo.Product) {
+		p.Name = "iPhone 12"
+		p.Price = repo.MustParseAmount("899")
+		p.Currency = "USD"
+	})
+
+	summary := summarizeHistory(prod)
+	r.Equal(int64(0), summary.NumOfChanges)
+	r.Nil(summary.PreviousPrice)
+	r.Equal(int64(899), summary.MinPrice.Units)
+	r.Equal(int64(899), summary.MaxPrice.Units)
+
+	prod.Changes = []repo.Change{
+		{Price: repo.MustParseAmount("999")},
+		{Price: repo.MustParseAmount("100000"), Currency: "KZT"},
+		{Price: repo.MustParseAmount("849.99"), Currency: "USD"},
+		{Price: repo.MustParseAmount("949"), Currency: "USD", ChangedAt: time.Now(), Actor: "admin", Reason: "typo"},
+	}
+
+	summary = summarizeHistory(prod)
+	r.Equal(int64(4), summary.NumOfChanges)
+	r.NotNil(summary.LastChangedAt)
+	r.Equal("admin", summary.LastChangedBy)
+	r.Equal("typo", summary.LastChangeReason)
+	r.Equal(int64(949), summary.PreviousPrice.Units)
+	r.Equal(int64(849), summary.MinPrice.Units)
+	r.Equal(int32(990000000), summary.MinPrice.Nanos)
+	r.Equal(int64(999), summary.MaxPrice.Units)
+	r.Equal("USD", summary.MaxPrice.Currency)
+}
+
+func TestServerSearchValidation(t *testing.T) {
+	srv := &server{}
+
+	for _, in := range []*pb.SearchRequest{
+		{},
+		{Query: "  "},
+		{Query: "iphone", Offset: -1},
+		{Query: "iphone", Limit: -1},
+	} {
+		_, err := srv.Search(context.Background(), in)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestServerGetProductValidation(t *testing.T) {
+	srv := &server{}
+
+	for _, in := range []*pb.GetProductRequest{
+		{},
+		{Key: &pb.GetProductRequest_Id{Id: "invalid"}},
+		{Key: &pb.GetProductRequest_Sku{}},
+	} {
+		_, err := srv.GetProduct(context.Background(), in)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *server) ListQuarantined(ctx context.Context, in *pb.ListQuarantinedRequest) (*pb.ListQuarantinedResponse, error) {
+	paging := &repo.Pager{}
+	if in.Paging != nil {
+		paging.Limit = in.Paging.Limit
+
+		if in.Paging.LastId != "" {
+			id, err := primitive.ObjectIDFromHex(in.Paging.LastId)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+			}
+
+			paging.LastID = id
+		}
+	}
+
+	items, err := s.repo.ListQuarantined(ctx, paging)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve quarantined products")
+	}
+
+	resp := &pb.ListQuarantinedResponse{
+		LastId:   "",
+		Products: make([]*pb.QuarantinedProduct, 0, len(items)),
+	}
+
+	if len(items) > 0 {
+		resp.LastId = items[len(items)-1].ID.Hex()
+	}
+
+	for _, q := range items {
+		resp.Products = append(resp.Products, &pb.QuarantinedProduct{
+			Id:        q.ID.Hex(),
+			Name:      q.Name,
+			Price:     newMoney(q.Price, q.Currency),
+			Reason:    q.Reason,
+			Source:    q.Source,
+			CreatedAt: timestamppb.New(q.CreatedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *server) ApproveQuarantined(ctx context.Context, in *pb.ApproveQuarantinedRequest) (*pb.ApproveQuarantinedResponse, error) {
+	q, err := s.findQuarantined(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	prod := repo.NewProduct()
+	prod.Name = q.Name
+	prod.Price = q.Price
+	prod.Currency = q.Currency
+	prod.UpdatedAt = time.Now().UTC()
+
+	err = s.repo.SaveProduct(ctx, prod, repo.WithAudit(_importActor, q.Source))
+	if errors.Is(err, repo.ErrPinned) {
+		return nil, status.Errorf(codes.FailedPrecondition, "product price is pinned")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not save product")
+	}
+
+	rules, err := s.alertRules(ctx)
+	if err == nil {
+		err = s.evaluateAlerts(ctx, rules, prod.Name)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not evaluate alerts")
+	}
+
+	if err := s.repo.DeleteQuarantined(ctx, q.ID); err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.Internal, "could not release quarantined product")
+	}
+
+	return &pb.ApproveQuarantinedResponse{}, nil
+}
+
+func (s *server) RejectQuarantined(ctx context.Context, in *pb.RejectQuarantinedRequest) (*pb.RejectQuarantinedResponse, error) {
+	q, err := s.findQuarantined(ctx, in.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DeleteQuarantined(ctx, q.ID); err != nil && !errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.Internal, "could not reject quarantined product")
+	}
+
+	return &pb.RejectQuarantinedResponse{}, nil
+}
+
+func (s *server) findQuarantined(ctx context.Context, hex string) (*repo.Quarantined, error) {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	q, err := s.repo.FindQuarantined(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "quarantined product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve quarantined product")
+	}
+
+	return q, nil
+}
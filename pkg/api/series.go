@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const _maxSeriesBuckets = 1000
+
+func (s *server) GetPriceSeries(ctx context.Context, in *pb.GetPriceSeriesRequest) (*pb.GetPriceSeriesResponse, error) {
+	opts, err := buildSeriesOptions(in, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var prod *repo.Product
+
+	switch key := in.Key.(type) {
+	case *pb.GetPriceSeriesRequest_Id:
+		id, perr := primitive.ObjectIDFromHex(key.Id)
+		if perr != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+		}
+		prod, err = s.repo.FindByID(ctx, id)
+	case *pb.GetPriceSeriesRequest_Name:
+		prod, err = s.repo.FindByName(ctx, key.Name)
+	case *pb.GetPriceSeriesRequest_Sku:
+		if key.Sku == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "sku must not be empty")
+		}
+		prod, err = s.repo.FindBySKU(ctx, key.Sku)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "id, name or sku must be specified")
+	}
+
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "product not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve product")
+	}
+
+	buckets, err := prod.PriceSeries(opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not build price series")
+	}
+
+	resp := &pb.GetPriceSeriesResponse{
+		Id:      prod.ID.Hex(),
+		Name:    prod.Name,
+		Buckets: make([]*pb.PriceBucket, 0, len(buckets)),
+	}
+
+	for _, b := range buckets {
+		resp.Buckets = append(resp.Buckets, &pb.PriceBucket{
+			Start: timestamppb.New(b.Start),
+			Open:  newMoney(b.Open, b.Currency),
+			Close: newMoney(b.Close, b.Currency),
+			Min:   newMoney(b.Min, b.Currency),
+			Max:   newMoney(b.Max, b.Currency),
+		})
+	}
+
+	return resp, nil
+}
+
+func buildSeriesOptions(in *pb.GetPriceSeriesRequest, now time.Time) (*repo.SeriesOptions, error) {
+	opts := &repo.SeriesOptions{To: now}
+
+	switch in.Interval {
+	case pb.SeriesInterval_HOUR:
+		opts.Interval = time.Hour
+	case pb.SeriesInterval_WEEK:
+		opts.Interval = 7 * 24 * time.Hour
+	default:
+		opts.Interval = 24 * time.Hour
+	}
+
+	if in.From == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "start of the range must be specified")
+	}
+	opts.From = in.From.AsTime()
+
+	if in.To != nil && in.To.AsTime().Before(now) {
+		opts.To = in.To.AsTime()
+	}
+
+	if !opts.From.Before(opts.To) {
+		return nil, status.Errorf(codes.InvalidArgument, "range must start before it ends and before now")
+	}
+
+	if n := opts.To.Sub(opts.From.Truncate(opts.Interval)) / opts.Interval; n >= _maxSeriesBuckets {
+		return nil, status.Errorf(codes.InvalidArgument, "range must not exceed %d intervals", _maxSeriesBuckets)
+	}
+
+	return opts, nil
+}
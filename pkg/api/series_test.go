@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBuildSeriesOptions(t *testing.T) {
+	var (
+		now   = time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+		day   = 24 * time.Hour
+		start = now.Add(-7 * day)
+	)
+
+	testCases := []struct {
+		Name     string
+		Request  *store.GetPriceSeriesRequest
+		Code     codes.Code
+		Interval time.Duration
+		To       time.Time
+	}{
+		{
+			Name:     "Daily",
+			Request:  &store.GetPriceSeriesRequest{From: timestamppb.New(start)},
+			Interval: day,
+			To:       now,
+		},
+		{
+			Name: "Hourly",
+			Request: &store.GetPriceSeriesRequest{
+				From:     timestamppb.New(start),
+				To:       timestamppb.New(start.Add(day)),
+				Interval: store.SeriesInterval_HOUR,
+			},
+			Interval: time.Hour,
+			To:       start.Add(day),
+		},
+		{
+			Name: "FutureEnd",
+			Request: &store.GetPriceSeriesRequest{
+				From:     timestamppb.New(start),
+				To:       timestamppb.New(now.Add(day)),
+				Interval: store.SeriesInterval_WEEK,
+			},
+			Interval: 7 * day,
+			To:       now,
+		},
+		{
+			Name:    "NoStart",
+			Request: &store.GetPriceSeriesRequest{},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "FutureStart",
+			Request: &store.GetPriceSeriesRequest{From: timestamppb.New(now.Add(time.Hour))},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "TooManyBuckets",
+			Request: &store.GetPriceSeriesRequest{From: timestamppb.New(now.Add(-_maxSeriesBuckets * time.Hour)), Interval: store.SeriesInterval_HOUR},
+			Code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			opts, err := buildSeriesOptions(tc.Request, now)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(start, opts.From)
+			r.Equal(tc.To, opts.To)
+			r.Equal(tc.Interval, opts.Interval)
+		})
+	}
+}
+
+func TestServerGetPriceSeriesValidation(t *testing.T) {
+	var (
+		srv  = &server{}
+		from = timestamppb.New(time.Now().Add(-time.Hour))
+	)
+
+	for _, in := range []*store.GetPriceSeriesRequest{
+		{From: from},
+		{From: from, Key: &store.GetPriceSeriesRequest_Id{Id: "invalid"}},
+		{From: from, Key: &store.GetPriceSeriesRequest_Sku{}},
+	} {
+		_, err := srv.GetPriceSeries(context.Background(), in)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestServerGetPriceSeries(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	for _, csv := range []string{
+		"PRODUCT NAME;PRICE\niPhone 12;999\n",
+		"PRODUCT NAME;PRICE\niPhone 12;899\n",
+	} {
+		_, err = srv.readCSV(ctx, strings.NewReader(csv), &feed{currency: repo.DefaultCurrency})
+		r.NoError(err)
+	}
+
+	from := timestamppb.New(time.Now().Add(-time.Hour))
+
+	resp, err := srv.GetPriceSeries(ctx, &store.GetPriceSeriesRequest{
+		Key:      &store.GetPriceSeriesRequest_Name{Name: "iPhone 12"},
+		From:     from,
+		Interval: store.SeriesInterval_HOUR,
+	})
+	r.NoError(err)
+	r.Equal("iPhone 12", resp.Name)
+	r.NotEmpty(resp.Buckets)
+
+	last := resp.Buckets[len(resp.Buckets)-1]
+	r.Equal(int64(899), last.Close.Units)
+	r.Equal("USD", last.Close.Currency)
+
+	_, err = srv.GetPriceSeries(ctx, &store.GetPriceSeriesRequest{
+		Key:  &store.GetPriceSeriesRequest_Name{Name: "iPhone 13"},
+		From: from,
+	})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	_, err = srv.GetPriceSeries(ctx, &store.GetPriceSeriesRequest{From: from})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
@@ -2,65 +2,143 @@ package api
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"regexp"
 	"time"
 
 	"github.com/danikarik/product-storage/pkg/repo"
 	pb "github.com/danikarik/product-storage/pkg/store"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-const _defaultTimeout = 30 * time.Second
+const (
+	_defaultTimeout   = 30 * time.Second
+	_defaultRetention = 30 * 24 * time.Hour
+)
 
 type server struct {
 	pb.UnimplementedStoreServer
 
-	repo    repo.Repository
-	timeout time.Duration
-	hclient *http.Client
+	repo      repo.Repository
+	timeout   time.Duration
+	retention time.Duration
+	hclient   *http.Client
+	rules     Rules
 }
 
-// Options holds server configuration.
-type Options struct{ Timeout time.Duration }
+// Options holds server configuration, zero values are replaced by defaults.
+type Options struct {
+	Timeout time.Duration
+	Rules   Rules
+	// Retention is a period after soft deletion when product can not be
+	// purged yet.
+	Retention time.Duration
+}
 
 // NewServer returns server stub with implemented methods.
 func NewServer(repo repo.Repository, opts *Options) *grpc.Server {
-	if opts == nil {
-		opts = &Options{Timeout: _defaultTimeout}
-	}
+	s := grpc.NewServer()
+	pb.RegisterStoreServer(s, newServer(repo, opts))
+	return s
+}
 
+func newServer(repo repo.Repository, opts *Options) *server {
 	srv := &server{
 		repo:    repo,
-		timeout: opts.Timeout,
 		hclient: &http.Client{},
 	}
 
-	s := grpc.NewServer()
-	pb.RegisterStoreServer(s, srv)
-	return s
+	if opts != nil {
+		srv.timeout = opts.Timeout
+		srv.retention = opts.Retention
+		srv.rules = opts.Rules
+	}
+
+	if srv.timeout <= 0 {
+		srv.timeout = _defaultTimeout
+	}
+	if srv.retention <= 0 {
+		srv.retention = _defaultRetention
+	}
+
+	return srv
 }
 
 func (s *server) Fetch(ctx context.Context, in *pb.FetchRequest) (*pb.FetchResponse, error) {
-	if err := s.fetchData(ctx, in.Url); err != nil {
+	currency, err := normalizeCurrency(in.Currency, repo.DefaultCurrency)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	f := &feed{
+		url:        in.Url,
+		currency:   currency,
+		dryRun:     in.DryRun,
+		duplicates: in.Duplicates,
+	}
+
+	result, err := s.fetchData(ctx, f)
+	if err != nil {
 		return nil, err
 	}
 
-	return &pb.FetchResponse{Result: 0}, nil
+	return result.response(), nil
+}
+
+func (s *server) FetchPreview(in *pb.FetchRequest, stream pb.Store_FetchPreviewServer) error {
+	currency, err := normalizeCurrency(in.Currency, repo.DefaultCurrency)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	f := &feed{
+		url:        in.Url,
+		currency:   currency,
+		dryRun:     true,
+		duplicates: in.Duplicates,
+		diff: func(d *pb.ProductDiff) error {
+			if d.Kind == pb.DiffKind_UNCHANGED {
+				return nil
+			}
+
+			return stream.Send(&pb.FetchPreviewResponse{
+				Item: &pb.FetchPreviewResponse_Diff{Diff: d},
+			})
+		},
+	}
+
+	result, err := s.fetchData(stream.Context(), f)
+	if err != nil {
+		return err
+	}
+
+	return stream.Send(&pb.FetchPreviewResponse{
+		Item: &pb.FetchPreviewResponse_Summary{Summary: result.response()},
+	})
 }
 
 func (s *server) List(ctx context.Context, in *pb.ListRequest) (*pb.ListResponse, error) {
-	if in.Paging == nil || in.Sorting == nil {
+	if in.Paging == nil {
 		return nil, status.Errorf(codes.InvalidArgument, "url must be specified")
 	}
 
-	opts, err := buildListOptions(in)
+	opts, page, err := buildListOptions(in)
 	if err != nil {
 		return nil, err
 	}
 
+	currency, err := normalizeCurrency(in.Currency, "")
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	// one extra product tells whether there are more pages
+	limit := opts.Paging.Limit
+	opts.Paging.Limit++
+
 	products, err := s.repo.ListProducts(ctx, opts)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "could not retrieve products")
@@ -71,50 +149,222 @@ func (s *server) List(ctx context.Context, in *pb.ListRequest) (*pb.ListResponse
 		Products: make([]*pb.Product, 0),
 	}
 
-	if len(products) > 0 {
-		resp.LastId = products[len(products)-1].ID.Hex()
+	if !in.SkipTotalCount {
+		resp.TotalCount, err = s.repo.CountProducts(ctx, opts.Filter)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not count products")
+		}
+	}
+
+	products = page.fill(resp, opts, products, limit)
+
+	// prices of the past are converted at rates effective then
+	at := time.Now().UTC()
+	if opts.Filter != nil && !opts.Filter.AsOf.IsZero() {
+		at = opts.Filter.AsOf
 	}
 
+	// prices are not loaded unless the mask selects them
+	convert := currency != "" && maskSelects(in.ReadMask, "price", "amount")
+
 	for _, p := range products {
-		resp.Products = append(resp.Products, &pb.Product{
-			Name:         p.Name,
-			Price:        p.Price,
-			NumOfChanges: int64(len(p.Changes)),
-			LastUpdate:   p.UpdatedAt.String(),
-		})
+		price, priceCurrency := p.Price, p.PriceCurrency()
+		if convert {
+			price, err = s.convert(ctx, p.Price, priceCurrency, currency, at)
+			if errors.Is(err, repo.ErrNotFound) {
+				return nil, status.Errorf(codes.FailedPrecondition, "no exchange rate from %s to %s", priceCurrency, currency)
+			}
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "could not convert price")
+			}
+		}
+		if currency != "" {
+			priceCurrency = currency
+		}
+
+		prod := newProduct(&p, price, priceCurrency)
+		applyMask(prod, in.ReadMask)
+
+		resp.Products = append(resp.Products, prod)
 	}
 
 	return resp, nil
 }
 
-func buildListOptions(in *pb.ListRequest) (*repo.ListOptions, error) {
-	opts := &repo.ListOptions{}
+// newProduct returns product with its price in the given currency.
+func newProduct(p *repo.Product, price repo.Amount, currency string) *pb.Product {
+	return &pb.Product{
+		Name:              p.Name,
+		Price:             price.Float64(),
+		NumOfChanges:      numOfChanges(p),
+		LastUpdate:        p.UpdatedAt.String(),
+		Currency:          currency,
+		Amount:            newMoney(price, currency),
+		LastChangePercent: p.LastChangePercent,
+		UpdatedAt:         newTimestamp(p.UpdatedAt),
+		CreatedAt:         newTimestamp(p.CreatedAt),
+		DeletedAt:         deletionTime(p),
+		Pinned:            p.Pinned,
+		Stale:             p.Stale,
+		LastSeenAt:        newTimestamp(p.LastSeenAt),
+	}
+}
 
-	opts.Direction = repo.Desc
-	if in.Sorting.Direction == pb.Direction_ASC {
-		opts.Direction = repo.Asc
+// numOfChanges returns denormalised number of changes, history is counted
+// for products saved before it was introduced and not migrated yet.
+func numOfChanges(p *repo.Product) int64 {
+	if p.NumOfChanges == 0 {
+		return int64(len(p.Changes))
 	}
+	return p.NumOfChanges
+}
+
+func buildListOptions(in *pb.ListRequest) (*repo.ListOptions, *pageToken, error) {
+	opts := &repo.ListOptions{Direction: repo.Desc}
 
-	switch in.Sorting.Field {
+	for i, sorting := range in.Sorting {
+		key := buildSortKey(sorting)
+		if i == 0 {
+			opts.Sorting, opts.Direction = key.Sorting, key.Direction
+			continue
+		}
+
+		opts.ThenBy = append(opts.ThenBy, key)
+	}
+
+	if in.Paging.Limit < 0 {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	page, err := currentPage(in.Paging, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limit := in.Paging.Limit
+	if limit == 0 {
+		limit = _defaultLimit
+	}
+
+	opts.Paging = page.pager(limit)
+
+	if in.Filter != nil {
+		filter, err := buildFilter(in.Filter)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		opts.Filter = filter
+	}
+
+	if in.IncludeDeleted {
+		if opts.Filter == nil {
+			opts.Filter = &repo.Filter{}
+		}
+		opts.Filter.IncludeDeleted = true
+	}
+
+	if in.AsOf != nil {
+		if opts.Filter == nil {
+			opts.Filter = &repo.Filter{}
+		}
+		opts.Filter.AsOf = in.AsOf.AsTime()
+	}
+
+	if err := validateMask(in.ReadMask, &pb.Product{}); err != nil {
+		return nil, nil, err
+	}
+	opts.Fields = productProjection(in.ReadMask)
+
+	return opts, page, nil
+}
+
+func buildSortKey(in *pb.Sorting) repo.SortKey {
+	key := repo.SortKey{Direction: repo.Desc}
+	if in.Direction == pb.Direction_ASC {
+		key.Direction = repo.Asc
+	}
+
+	switch in.Field {
 	case pb.Field_NAME:
-		opts.Sorting = repo.SortByName
+		key.Sorting = repo.SortByName
 	case pb.Field_PRICE:
-		opts.Sorting = repo.SortByPrice
+		key.Sorting = repo.SortByPrice
 	case pb.Field_UPDATED:
-		opts.Sorting = repo.SortByUpdatedAt
+		key.Sorting = repo.SortByUpdatedAt
+	case pb.Field_NUM_OF_CHANGES:
+		key.Sorting = repo.SortByNumOfChanges
+	case pb.Field_LAST_CHANGE_PERCENT:
+		key.Sorting = repo.SortByLastChangePercent
+	case pb.Field_CREATED:
+		key.Sorting = repo.SortByCreatedAt
 	default:
-		opts.Sorting = repo.SortByDefault
+		key.Sorting = repo.SortByDefault
+	}
+
+	return key
+}
+
+func buildFilter(in *pb.Filter) (*repo.Filter, error) {
+	filter := &repo.Filter{
+		NamePrefix:       in.NamePrefix,
+		NameContains:     in.NameContains,
+		NameRegex:        in.NameRegex,
+		MinChanges:       int(in.MinChanges),
+		MinChangePercent: in.MinChangePercent,
+		Stale:            in.Stale,
+	}
+
+	if in.NameRegex != "" {
+		if _, err := regexp.Compile(in.NameRegex); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid name regex: %v", err)
+		}
+	}
+
+	if in.MinChanges < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "min changes must not be negative")
+	}
+
+	if in.MinChangePercent < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "min change percent must not be negative")
 	}
 
-	opts.Paging = &repo.Pager{Limit: in.Paging.Limit}
-	if in.Paging.LastId != "" {
-		id, err := primitive.ObjectIDFromHex(in.Paging.LastId)
+	for _, bound := range []struct {
+		money *pb.Money
+		price **repo.Amount
+	}{
+		{in.MinPrice, &filter.MinPrice},
+		{in.MaxPrice, &filter.MaxPrice},
+	} {
+		if bound.money == nil {
+			continue
+		}
+
+		amount, currency, err := parseMoney(bound.money)
 		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+			return nil, status.Errorf(codes.InvalidArgument, "invalid price bound: %v", err)
+		}
+
+		if currency != "" {
+			if filter.Currency != "" && filter.Currency != currency {
+				return nil, status.Errorf(codes.InvalidArgument, "price bounds must share currency")
+			}
+			filter.Currency = currency
 		}
 
-		opts.Paging.LastID = id
+		*bound.price = &amount
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && filter.MinPrice.Cmp(*filter.MaxPrice) > 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "min price exceeds max price")
+	}
+
+	if in.UpdatedAfter != nil {
+		filter.UpdatedAfter = in.UpdatedAfter.AsTime()
+	}
+	if in.UpdatedBefore != nil {
+		filter.UpdatedBefore = in.UpdatedBefore.AsTime()
 	}
 
-	return opts, nil
+	return filter, nil
 }
@@ -3,17 +3,39 @@ package api
 import (
 	"context"
 	"net/http"
+	"os"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danikarik/product-storage/pkg/repo"
 	"github.com/danikarik/product-storage/pkg/store"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+func TestNewServer(t *testing.T) {
+	r := require.New(t)
+
+	for _, opts := range []*Options{nil, {Timeout: time.Second}} {
+		srv := newServer(nil, opts)
+		r.Equal(_defaultRetention, srv.retention)
+		r.NotNil(srv.hclient)
+	}
+
+	r.Equal(_defaultTimeout, newServer(nil, &Options{}).timeout)
+
+	srv := newServer(nil, &Options{Timeout: time.Second, Retention: time.Hour})
+	r.Equal(time.Second, srv.timeout)
+	r.Equal(time.Hour, srv.retention)
+}
+
 func TestServerFetch(t *testing.T) {
 	ctx := context.Background()
 
@@ -129,7 +151,7 @@ func TestServerList(t *testing.T) {
 
 			result, err := srv.List(ctx, &store.ListRequest{
 				Paging:  tc.Paging,
-				Sorting: tc.Sorting,
+				Sorting: []*store.Sorting{tc.Sorting},
 			})
 
 			r.NoError(err)
@@ -144,7 +166,7 @@ func TestServerList(t *testing.T) {
 						LastId: result.LastId,
 						Limit:  tc.Paging.Limit,
 					},
-					Sorting: &store.Sorting{},
+					Sorting: []*store.Sorting{{}},
 				})
 
 				r.NoError(err)
@@ -157,6 +179,660 @@ func TestServerList(t *testing.T) {
 	}
 }
 
+func TestServerListCurrency(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	file, err := os.Open("testdata/currencies.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	_, err = srv.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	listReq := &store.ListRequest{
+		Paging:   &store.Paging{},
+		Sorting:  []*store.Sorting{{}},
+		Currency: "KZT",
+	}
+
+	// no rates yet
+	_, err = srv.List(ctx, listReq)
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	// prices are not converted unless they are selected
+	masked, err := srv.List(ctx, &store.ListRequest{
+		Paging:   &store.Paging{},
+		Currency: "KZT",
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "currency"}},
+	})
+	r.NoError(err)
+	r.Len(masked.Products, 5)
+	r.Equal("KZT", masked.Products[0].Currency)
+	r.Nil(masked.Products[0].Amount)
+
+	_, err = srv.List(ctx, &store.ListRequest{
+		Paging:   &store.Paging{},
+		Currency: "KZT",
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "amount.units"}},
+	})
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+
+	effectiveAt := timestamppb.New(time.Now().Add(-time.Hour))
+	for _, rate := range []*store.Rate{
+		{From: "usd", To: "kzt", Rate: 420, EffectiveAt: effectiveAt},
+		{From: "EUR", To: "KZT", Rate: 500, EffectiveAt: effectiveAt},
+		{From: "EUR", To: "USD", Rate: 1.25, EffectiveAt: effectiveAt},
+	} {
+		_, err = srv.SetRate(ctx, &store.SetRateRequest{Rate: rate})
+		r.NoError(err)
+	}
+
+	result, err := srv.List(ctx, listReq)
+	r.NoError(err)
+	r.Len(result.Products, 5)
+
+	expected := map[string]string{
+		"Apple iPhone 12":     "377580",
+		"Apple iPhone 12 PRO": "461580",
+		"Samsung Galaxy S20":  "399500",
+		"Xiaomi Mi 10":        "329990",
+		"Google Pixel 5":      "293580",
+	}
+
+	for _, p := range result.Products {
+		r.Equal("KZT", p.Currency)
+		r.Equal("KZT", p.Amount.Currency)
+		r.True(p.UpdatedAt.IsValid())
+		r.Equal(p.CreatedAt.AsTime(), p.UpdatedAt.AsTime())
+
+		amount, err := repo.NewAmount(p.Amount.Units, p.Amount.Nanos)
+		r.NoError(err)
+		r.Equal(expected[p.Name], amount.String(), p.Name)
+	}
+
+	// inverse rate is used when direct one is missing
+	listReq.Currency = "EUR"
+	result, err = srv.List(ctx, listReq)
+	r.NoError(err)
+
+	for _, p := range result.Products {
+		r.Equal("EUR", p.Currency)
+
+		switch p.Name {
+		case "Apple iPhone 12":
+			r.Equal(int64(719), p.Amount.Units)
+			r.Equal(int32(200000000), p.Amount.Nanos)
+		case "Xiaomi Mi 10":
+			r.Equal(int64(659), p.Amount.Units)
+			r.Equal(int32(980000000), p.Amount.Nanos)
+		}
+	}
+}
+
+func TestServerListPages(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	file, err := os.Open("testdata/currencies.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	_, err = srv.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	listReq := &store.ListRequest{
+		Paging:  &store.Paging{Limit: 2},
+		Sorting: []*store.Sorting{{}},
+	}
+
+	var names []string
+
+	for page := int64(1); ; page++ {
+		result, err := srv.List(ctx, listReq)
+		r.NoError(err)
+		r.Equal(int64(5), result.TotalCount)
+		r.Equal(page, result.Page)
+		r.Equal(page > 1, result.PrevPageToken != "")
+		r.Equal(result.HasMore, result.NextPageToken != "")
+
+		for _, p := range result.Products {
+			names = append(names, p.Name)
+		}
+
+		if !result.HasMore {
+			r.Equal(int64(3), page)
+			r.Len(result.Products, 1)
+
+			// going back returns the same products as going forward
+			prev, err := srv.List(ctx, &store.ListRequest{
+				Paging:         &store.Paging{Limit: 2, PageToken: result.PrevPageToken},
+				Sorting:        []*store.Sorting{{}},
+				SkipTotalCount: true,
+			})
+			r.NoError(err)
+			r.Equal(int64(0), prev.TotalCount)
+			r.Equal(int64(2), prev.Page)
+			r.True(prev.HasMore)
+			r.Len(prev.Products, 2)
+			r.Equal(names[2:4], []string{prev.Products[0].Name, prev.Products[1].Name})
+			break
+		}
+
+		listReq.Paging.PageToken = result.NextPageToken
+	}
+
+	r.Len(names, 5)
+
+	// filter is applied to the total count
+	result, err := srv.List(ctx, &store.ListRequest{
+		Paging:  &store.Paging{},
+		Sorting: []*store.Sorting{{}},
+		Filter:  &store.Filter{NamePrefix: "Apple"},
+	})
+	r.NoError(err)
+	r.Equal(int64(2), result.TotalCount)
+	r.False(result.HasMore)
+	r.Empty(result.NextPageToken)
+
+	// read mask is applied to products, cursors are still returned
+	result, err = srv.List(ctx, &store.ListRequest{
+		Paging:   &store.Paging{Limit: 2},
+		Sorting:  []*store.Sorting{{Field: store.Field_PRICE}},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	r.NoError(err)
+	r.Len(result.Products, 2)
+	r.NotEmpty(result.Products[0].Name)
+	r.Nil(result.Products[0].Amount)
+	r.Zero(result.Products[0].NumOfChanges)
+
+	next, err := srv.List(ctx, &store.ListRequest{
+		Paging:   &store.Paging{Limit: 2, PageToken: result.NextPageToken},
+		Sorting:  []*store.Sorting{{Field: store.Field_PRICE}},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	r.NoError(err)
+	r.Len(next.Products, 2)
+	r.NotContains(productNames(result.Products), next.Products[0].Name)
+
+	_, err = srv.List(ctx, &store.ListRequest{
+		Paging:  &store.Paging{PageToken: "???"},
+		Sorting: []*store.Sorting{{}},
+	})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerListBackward(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	file, err := os.Open("testdata/currencies.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	_, err = srv.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	for _, sorting := range []*store.Sorting{
+		{Field: store.Field_NAME, Direction: store.Direction_DESC},
+		{Field: store.Field_PRICE, Direction: store.Direction_ASC},
+		{},
+	} {
+		t.Run(sorting.Field.String()+"_"+sorting.Direction.String(), func(t *testing.T) {
+			r := require.New(t)
+
+			all, err := srv.List(ctx, &store.ListRequest{Paging: &store.Paging{}, Sorting: []*store.Sorting{sorting}})
+			r.NoError(err)
+			r.Len(all.Products, 5)
+
+			forward := productNames(all.Products)
+
+			result, err := srv.List(ctx, &store.ListRequest{
+				Paging:  &store.Paging{Limit: 2, LastPage: true},
+				Sorting: []*store.Sorting{sorting},
+			})
+			r.NoError(err)
+			r.Equal(int64(3), result.Page)
+			r.False(result.HasMore)
+			r.Equal(forward[4:], productNames(result.Products))
+
+			var backward []string
+			for {
+				backward = append(productNames(result.Products), backward...)
+
+				if result.PrevPageToken == "" {
+					break
+				}
+
+				result, err = srv.List(ctx, &store.ListRequest{
+					Paging:  &store.Paging{Limit: 2, PageToken: result.PrevPageToken},
+					Sorting: []*store.Sorting{sorting},
+				})
+				r.NoError(err)
+				r.True(result.HasMore)
+			}
+
+			r.Equal(int64(1), result.Page)
+			r.Equal(forward, backward)
+
+			// cursors page the same way as tokens
+			after, err := srv.List(ctx, &store.ListRequest{
+				Paging:  &store.Paging{Limit: 2, After: result.EndCursor},
+				Sorting: []*store.Sorting{sorting},
+			})
+			r.NoError(err)
+			r.Equal(forward[len(result.Products)], after.Products[0].Name)
+
+			before, err := srv.List(ctx, &store.ListRequest{
+				Paging:  &store.Paging{Limit: 2, Before: after.StartCursor},
+				Sorting: []*store.Sorting{sorting},
+			})
+			r.NoError(err)
+			r.Equal(productNames(result.Products), productNames(before.Products))
+
+			// cursor is bound to the sorting
+			_, err = srv.List(ctx, &store.ListRequest{
+				Paging:  &store.Paging{Limit: 2, After: result.EndCursor},
+				Sorting: []*store.Sorting{{Field: store.Field_UPDATED}},
+			})
+			r.Equal(codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestServerListMultiSort(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	file, err := os.Open("testdata/ties.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	_, err = srv.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	testCases := []struct {
+		Name     string
+		Sorting  []*store.Sorting
+		Expected []string
+	}{
+		{
+			Name: "PriceAscNameAsc",
+			Sorting: []*store.Sorting{
+				{Field: store.Field_PRICE, Direction: store.Direction_ASC},
+				{Field: store.Field_NAME, Direction: store.Direction_ASC},
+			},
+			Expected: []string{"Cherry", "Elderberry", "Apple", "Banana", "Date"},
+		},
+		{
+			Name: "PriceDescNameAsc",
+			Sorting: []*store.Sorting{
+				{Field: store.Field_PRICE, Direction: store.Direction_DESC},
+				{Field: store.Field_NAME, Direction: store.Direction_ASC},
+			},
+			Expected: []string{"Apple", "Banana", "Date", "Cherry", "Elderberry"},
+		},
+		{
+			Name: "PriceAscNameDesc",
+			Sorting: []*store.Sorting{
+				{Field: store.Field_PRICE, Direction: store.Direction_ASC},
+				{Field: store.Field_NAME, Direction: store.Direction_DESC},
+			},
+			Expected: []string{"Elderberry", "Cherry", "Date", "Banana", "Apple"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			listReq := &store.ListRequest{
+				Paging:  &store.Paging{Limit: 2},
+				Sorting: tc.Sorting,
+			}
+
+			var names []string
+			for {
+				result, err := srv.List(ctx, listReq)
+				r.NoError(err)
+
+				names = append(names, productNames(result.Products)...)
+				if !result.HasMore {
+					break
+				}
+
+				listReq.Paging.PageToken = result.NextPageToken
+			}
+
+			r.Equal(tc.Expected, names)
+		})
+	}
+}
+
+func productNames(products []*store.Product) []string {
+	names := make([]string, 0, len(products))
+	for _, p := range products {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestServerGetProduct(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	file, err := os.Open("testdata/skus.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	_, err = srv.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;899\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	resp, err := srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Sku{Sku: "APL-IP12"}})
+	r.NoError(err)
+
+	prod := resp.Product
+	r.Equal("iPhone 12", prod.Name)
+	r.Equal(int64(899), prod.Price.Units)
+	r.Equal("USD", prod.Price.Currency)
+	r.NotNil(prod.CreatedAt)
+	r.NotNil(prod.UpdatedAt)
+	r.Equal(int64(1), prod.History.NumOfChanges)
+	r.Equal(int64(999), prod.History.PreviousPrice.Units)
+	r.Equal(int64(899), prod.History.MinPrice.Units)
+	r.Equal(int64(999), prod.History.MaxPrice.Units)
+
+	byID, err := srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Id{Id: prod.Id}})
+	r.NoError(err)
+	r.Equal(prod.Name, byID.Product.Name)
+
+	byName, err := srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Name{Name: "Galaxy S20"}})
+	r.NoError(err)
+	r.Equal("EUR", byName.Product.Price.Currency)
+	r.Empty(byName.Product.Sku)
+
+	masked, err := srv.GetProduct(ctx, &store.GetProductRequest{
+		Key:      &store.GetProductRequest_Id{Id: prod.Id},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name", "price.units"}},
+	})
+	r.NoError(err)
+	r.Equal(prod.Name, masked.Product.Name)
+	r.Equal(int64(899), masked.Product.Price.Units)
+	r.Empty(masked.Product.Price.Currency)
+	r.Empty(masked.Product.Id)
+	r.Nil(masked.Product.History)
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{
+		Key:      &store.GetProductRequest_Id{Id: prod.Id},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"changes"}},
+	})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Name{Name: "iPhone 13"}})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{Key: &store.GetProductRequest_Id{Id: "invalid"}})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerAsOf(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	before := time.Now()
+
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	imported := time.Now()
+
+	// stored times have millisecond precision
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;899\nPixel 5;699\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	listReq := &store.ListRequest{Paging: &store.Paging{}, AsOf: timestamppb.New(imported)}
+
+	result, err := srv.List(ctx, listReq)
+	r.NoError(err)
+	r.Len(result.Products, 1)
+	r.Equal(int64(1), result.TotalCount)
+	r.Equal(int64(999), result.Products[0].Amount.Units)
+	r.Equal(int64(0), result.Products[0].NumOfChanges)
+
+	resp, err := srv.GetProduct(ctx, &store.GetProductRequest{
+		Key:  &store.GetProductRequest_Name{Name: "iPhone 12"},
+		AsOf: timestamppb.New(imported),
+	})
+	r.NoError(err)
+	r.Equal(int64(999), resp.Product.Price.Units)
+	r.Equal(int64(0), resp.Product.History.NumOfChanges)
+
+	resp, err = srv.GetProduct(ctx, &store.GetProductRequest{
+		Key:  &store.GetProductRequest_Name{Name: "iPhone 12"},
+		AsOf: timestamppb.Now(),
+	})
+	r.NoError(err)
+	r.Equal(int64(899), resp.Product.Price.Units)
+
+	_, err = srv.GetProduct(ctx, &store.GetProductRequest{
+		Key:  &store.GetProductRequest_Name{Name: "Pixel 5"},
+		AsOf: timestamppb.New(imported),
+	})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	listReq.AsOf = timestamppb.New(before)
+	result, err = srv.List(ctx, listReq)
+	r.NoError(err)
+	r.Empty(result.Products)
+}
+
+func TestNumOfChanges(t *testing.T) {
+	r := require.New(t)
+
+	changes := []repo.Change{{Price: repo.MustParseAmount("999")}, {Price: repo.MustParseAmount("899")}}
+
+	r.Equal(int64(2), numOfChanges(&repo.Product{NumOfChanges: 2, Changes: changes}))
+	// not migrated product
+	r.Equal(int64(2), numOfChanges(&repo.Product{Changes: changes}))
+	r.Zero(numOfChanges(&repo.Product{}))
+}
+
+func TestBuildFilter(t *testing.T) {
+	now := time.Now().UTC()
+
+	testCases := []struct {
+		Name     string
+		Filter   *store.Filter
+		Expected *repo.Filter
+	}{
+		{
+			Name:     "Empty",
+			Filter:   &store.Filter{},
+			Expected: &repo.Filter{},
+		},
+		{
+			Name: "Name",
+			Filter: &store.Filter{
+				NamePrefix:   "Apple",
+				NameContains: "pro",
+				NameRegex:    "^Apple .* Pro$",
+			},
+			Expected: &repo.Filter{
+				NamePrefix:   "Apple",
+				NameContains: "pro",
+				NameRegex:    "^Apple .* Pro$",
+			},
+		},
+		{
+			Name: "Price",
+			Filter: &store.Filter{
+				MinPrice: &store.Money{Units: 10, Nanos: 500000000},
+				MaxPrice: &store.Money{Units: 1000, Currency: "usd"},
+			},
+			Expected: func() *repo.Filter {
+				min, max := repo.MustParseAmount("10.5"), repo.MustParseAmount("1000")
+				return &repo.Filter{MinPrice: &min, MaxPrice: &max, Currency: "USD"}
+			}(),
+		},
+		{
+			Name: "Updated",
+			Filter: &store.Filter{
+				UpdatedAfter:  timestamppb.New(now.Add(-time.Hour)),
+				UpdatedBefore: timestamppb.New(now),
+				MinChanges:    3,
+			},
+			Expected: &repo.Filter{
+				UpdatedAfter:  now.Add(-time.Hour),
+				UpdatedBefore: now,
+				MinChanges:    3,
+			},
+		},
+		{
+			Name:     "Stale",
+			Filter:   &store.Filter{Stale: true, MinChangePercent: 5},
+			Expected: &repo.Filter{Stale: true, MinChangePercent: 5},
+		},
+		{
+			Name:   "InvalidRegex",
+			Filter: &store.Filter{NameRegex: "(unclosed"},
+		},
+		{
+			Name:   "NegativeChanges",
+			Filter: &store.Filter{MinChanges: -1},
+		},
+		{
+			Name:   "NegativeChangePercent",
+			Filter: &store.Filter{MinChangePercent: -1},
+		},
+		{
+			Name:   "InvalidMoney",
+			Filter: &store.Filter{MinPrice: &store.Money{Units: 1, Nanos: -1}},
+		},
+		{
+			Name: "CurrencyMismatch",
+			Filter: &store.Filter{
+				MinPrice: &store.Money{Units: 1, Currency: "USD"},
+				MaxPrice: &store.Money{Units: 10, Currency: "EUR"},
+			},
+		},
+		{
+			Name: "EmptyRange",
+			Filter: &store.Filter{
+				MinPrice: &store.Money{Units: 10},
+				MaxPrice: &store.Money{Units: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			filter, err := buildFilter(tc.Filter)
+			if tc.Expected == nil {
+				r.Equal(codes.InvalidArgument, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Expected, filter)
+		})
+	}
+}
+
 func testSortingOrder(t *testing.T, products []*store.Product, opts *store.Sorting) {
 	r := require.New(t)
 
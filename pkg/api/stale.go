@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const _maxStaleLimit = 1000
+
+func (s *server) ListStale(ctx context.Context, in *pb.ListStaleRequest) (*pb.ListStaleResponse, error) {
+	if _, ok := s.repo.(repo.StaleTracker); !ok {
+		return nil, status.Errorf(codes.Unimplemented, "stale products are not tracked by repository")
+	}
+
+	opts := &repo.ListOptions{
+		Direction: repo.Asc,
+		Sorting:   repo.SortByDefault,
+		Paging:    &repo.Pager{Limit: _defaultLimit},
+		Filter:    &repo.Filter{},
+	}
+
+	if in.Paging != nil {
+		if in.Paging.Limit < 0 || in.Paging.Limit > _maxStaleLimit {
+			return nil, status.Errorf(codes.InvalidArgument, "limit must be between 0 and %d", _maxStaleLimit)
+		}
+		if in.Paging.Limit > 0 {
+			opts.Paging.Limit = in.Paging.Limit
+		}
+
+		if in.Paging.LastId != "" {
+			id, err := primitive.ObjectIDFromHex(in.Paging.LastId)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+			}
+
+			opts.Paging.LastID = id
+		}
+	}
+
+	if in.Filter != nil {
+		var err error
+		if opts.Filter, err = buildFilter(in.Filter); err != nil {
+			return nil, err
+		}
+	}
+	opts.Filter.Stale = true
+
+	products, err := s.repo.ListProducts(ctx, opts)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve products")
+	}
+
+	resp := &pb.ListStaleResponse{
+		LastId:   "",
+		Products: make([]*pb.Product, 0, len(products)),
+	}
+
+	if len(products) > 0 {
+		resp.LastId = products[len(products)-1].ID.Hex()
+	}
+
+	for i := range products {
+		p := &products[i]
+		resp.Products = append(resp.Products, newProduct(p, p.Price, p.PriceCurrency()))
+	}
+
+	return resp, nil
+}
+
+// markSeen records products contained in the imported feed, it is a no-op
+// if repository does not track stale products.
+func (s *server) markSeen(ctx context.Context, names []string, at time.Time) error {
+	tracker, ok := s.repo.(repo.StaleTracker)
+	if !ok {
+		return nil
+	}
+
+	_, err := tracker.MarkSeen(ctx, names, at)
+	return err
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// staleRepo records options products are listed with.
+type staleRepo struct {
+	repo.Repository
+	opts *repo.ListOptions
+}
+
+func (r *staleRepo) ListProducts(ctx context.Context, opts *repo.ListOptions) ([]repo.Product, error) {
+	r.opts = opts
+	return nil, nil
+}
+
+func (r *staleRepo) MarkSeen(ctx context.Context, names []string, at time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *staleRepo) MarkStale(ctx context.Context, seenBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestServerListStaleLimit(t *testing.T) {
+	var (
+		ctx     = context.Background()
+		tracker = &staleRepo{}
+		srv     = &server{repo: tracker}
+	)
+
+	testCases := []struct {
+		Name    string
+		Request *pb.ListStaleRequest
+		Code    codes.Code
+		Limit   int64
+	}{
+		{Name: "NoPaging", Request: &pb.ListStaleRequest{}, Limit: _defaultLimit},
+		{Name: "ZeroLimit", Request: &pb.ListStaleRequest{Paging: &pb.Paging{}}, Limit: _defaultLimit},
+		{Name: "Limit", Request: &pb.ListStaleRequest{Paging: &pb.Paging{Limit: 50}}, Limit: 50},
+		{Name: "NegativeLimit", Request: &pb.ListStaleRequest{Paging: &pb.Paging{Limit: -1}}, Code: codes.InvalidArgument},
+		{Name: "LargeLimit", Request: &pb.ListStaleRequest{Paging: &pb.Paging{Limit: _maxStaleLimit + 1}}, Code: codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			_, err := srv.ListStale(ctx, tc.Request)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Limit, tracker.opts.Paging.Limit)
+			r.True(tracker.opts.Filter.Stale)
+		})
+	}
+}
+
+func TestServerListStale(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\niPhone 11;699\nPixel 5;699\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	// dry run does not tell that products are seen
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 11;699\n"), &feed{currency: repo.DefaultCurrency, dryRun: true})
+	r.NoError(err)
+
+	seen := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+
+	// unchanged products are seen too
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	n, err := srv.repo.(repo.StaleTracker).MarkStale(ctx, seen)
+	r.NoError(err)
+	r.Equal(int64(2), n)
+
+	resp, err := srv.ListStale(ctx, &pb.ListStaleRequest{Paging: &pb.Paging{Limit: 1}})
+	r.NoError(err)
+	r.Len(resp.Products, 1)
+	r.Equal("iPhone 11", resp.Products[0].Name)
+	r.True(resp.Products[0].Stale)
+	r.NotNil(resp.Products[0].LastSeenAt)
+
+	resp, err = srv.ListStale(ctx, &pb.ListStaleRequest{Paging: &pb.Paging{Limit: 10, LastId: resp.LastId}})
+	r.NoError(err)
+	r.Len(resp.Products, 1)
+	r.Equal("Pixel 5", resp.Products[0].Name)
+
+	resp, err = srv.ListStale(ctx, &pb.ListStaleRequest{Filter: &pb.Filter{NamePrefix: "iPhone"}})
+	r.NoError(err)
+	r.Len(resp.Products, 1)
+	r.Equal("iPhone 11", resp.Products[0].Name)
+
+	list, err := srv.List(ctx, &pb.ListRequest{
+		Paging: &pb.Paging{Limit: 10},
+		Filter: &pb.Filter{Stale: true},
+	})
+	r.NoError(err)
+	r.Equal(int64(2), list.TotalCount)
+
+	// product is not stale anymore once it is imported again
+	_, err = srv.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\nPixel 5;649\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	resp, err = srv.ListStale(ctx, &pb.ListStaleRequest{})
+	r.NoError(err)
+	r.Len(resp.Products, 1)
+	r.Equal("iPhone 11", resp.Products[0].Name)
+
+	_, err = srv.ListStale(ctx, &pb.ListStaleRequest{Paging: &pb.Paging{LastId: "invalid"}})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
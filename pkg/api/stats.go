@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	_defaultStatsWindow = 24 * time.Hour
+	_maxStatsNames      = 100
+)
+
+func (s *server) Stats(ctx context.Context, in *pb.StatsRequest) (*pb.StatsResponse, error) {
+	agg, ok := s.repo.(repo.Aggregator)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "statistics are not supported by repository")
+	}
+
+	if len(in.Names) > _maxStatsNames {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d names can be aggregated", _maxStatsNames)
+	}
+
+	filter := &repo.Filter{}
+	if in.Filter != nil {
+		var err error
+		if filter, err = buildFilter(in.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	since := time.Now().UTC().Add(-_defaultStatsWindow)
+	if in.Since != nil {
+		since = in.Since.AsTime()
+	}
+
+	catalogue, err := agg.CatalogueStats(ctx, filter, since)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not aggregate products")
+	}
+
+	resp := &pb.StatsResponse{
+		Since:     timestamppb.New(since),
+		Catalogue: newCatalogueStats(catalogue),
+		Products:  make([]*pb.ProductStats, 0, len(in.Names)),
+	}
+
+	for _, name := range in.Names {
+		stats, err := agg.ProductStats(ctx, name, since)
+		if errors.Is(err, repo.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "product %q not found", name)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not aggregate product history")
+		}
+
+		resp.Products = append(resp.Products, &pb.ProductStats{
+			Id:               stats.ID.Hex(),
+			Name:             stats.Name,
+			Prices:           newPriceStats(&stats.Prices),
+			NumOfChanges:     stats.NumOfChanges,
+			ChangesInWindow:  stats.ChangesInWindow,
+			AvgChangePercent: stats.AvgChangePercent,
+		})
+	}
+
+	return resp, nil
+}
+
+func newCatalogueStats(c *repo.CatalogueStats) *pb.CatalogueStats {
+	stats := &pb.CatalogueStats{
+		TotalProducts:    c.Total,
+		ChangedProducts:  c.Changed,
+		AvgChangePercent: c.AvgChangePercent,
+		Prices:           make([]*pb.PriceStats, 0, len(c.Prices)),
+	}
+
+	for i := range c.Prices {
+		stats.Prices = append(stats.Prices, newPriceStats(&c.Prices[i]))
+	}
+
+	return stats
+}
+
+func newPriceStats(p *repo.PriceStats) *pb.PriceStats {
+	return &pb.PriceStats{
+		Currency: p.Currency,
+		Count:    p.Count,
+		Min:      newMoney(p.Min, p.Currency),
+		Max:      newMoney(p.Max, p.Currency),
+		Avg:      newMoney(p.Avg, p.Currency),
+		Median:   newMoney(p.Median, p.Currency),
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerStats(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	srv := &server{
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+	}
+
+	for _, csv := range []string{
+		"PRODUCT NAME;PRICE\niPhone 12;999\nPixel 5;699\nGalaxy S21;799\n",
+		"PRODUCT NAME;PRICE\niPhone 12;899\n",
+	} {
+		_, err = srv.readCSV(ctx, strings.NewReader(csv), &feed{currency: repo.DefaultCurrency})
+		r.NoError(err)
+	}
+
+	resp, err := srv.Stats(ctx, &store.StatsRequest{Names: []string{"iPhone 12"}})
+	r.NoError(err)
+	r.NotNil(resp.Since)
+	r.Equal(int64(3), resp.Catalogue.TotalProducts)
+	r.Equal(int64(1), resp.Catalogue.ChangedProducts)
+	r.Len(resp.Catalogue.Prices, 1)
+	r.Equal("USD", resp.Catalogue.Prices[0].Currency)
+	r.Equal(int64(799), resp.Catalogue.Prices[0].Median.Units)
+	r.Len(resp.Products, 1)
+	r.Equal(int64(1), resp.Products[0].ChangesInWindow)
+	r.Equal(int64(949), resp.Products[0].Prices.Avg.Units)
+
+	resp, err = srv.Stats(ctx, &store.StatsRequest{Filter: &store.Filter{NamePrefix: "Pixel"}})
+	r.NoError(err)
+	r.Equal(int64(1), resp.Catalogue.TotalProducts)
+	r.Empty(resp.Products)
+
+	_, err = srv.Stats(ctx, &store.StatsRequest{Names: []string{"iPhone 13"}})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	_, err = srv.Stats(ctx, &store.StatsRequest{Filter: &store.Filter{MinChanges: -1}})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+
+	_, err = srv.Stats(ctx, &store.StatsRequest{Names: make([]string, _maxStatsNames+1)})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
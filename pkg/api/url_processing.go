@@ -7,84 +7,320 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-func (s *server) fetchData(ctx context.Context, url string) error {
-	if url == "" {
-		return status.Errorf(codes.InvalidArgument, "url must be specified")
+// _importActor is recorded in the price history for imported changes.
+const _importActor = "import"
+
+// feed describes imported data source.
+type feed struct {
+	url        string
+	currency   string
+	dryRun     bool
+	duplicates pb.DuplicatePolicy
+	// diff receives planned change of every row if set, otherwise changes
+	// are collected into result on dry run.
+	diff func(*pb.ProductDiff) error
+	// alerts are loaded once before the first saved product.
+	alerts       []repo.AlertRule
+	alertsLoaded bool
+}
+
+// importResult holds statistics of processed feed.
+type importResult struct {
+	inserted    int32
+	updated     int32
+	unchanged   int32
+	quarantined int32
+	pinned      int32
+
+	newProducts  []*pb.ProductDiff
+	priceChanges []*pb.ProductDiff
+	rejected     []*pb.ProductDiff
+	duplicates   []*pb.Duplicate
+}
+
+func (r *importResult) add(d *pb.ProductDiff, collect bool) {
+	switch d.Kind {
+	case pb.DiffKind_NEW:
+		r.inserted++
+		if collect {
+			r.newProducts = append(r.newProducts, d)
+		}
+	case pb.DiffKind_CHANGED:
+		r.updated++
+		if collect {
+			r.priceChanges = append(r.priceChanges, d)
+		}
+	case pb.DiffKind_QUARANTINED:
+		r.quarantined++
+		if collect {
+			r.rejected = append(r.rejected, d)
+		}
+	case pb.DiffKind_PINNED:
+		r.pinned++
+		if collect {
+			r.rejected = append(r.rejected, d)
+		}
+	default:
+		r.unchanged++
+	}
+}
+
+func (r *importResult) response() *pb.FetchResponse {
+	return &pb.FetchResponse{
+		Result:       0,
+		Quarantined:  r.quarantined,
+		Inserted:     r.inserted,
+		Updated:      r.updated,
+		Unchanged:    r.unchanged,
+		NewProducts:  r.newProducts,
+		PriceChanges: r.priceChanges,
+		Rejected:     r.rejected,
+		Duplicates:   r.duplicates,
+		Pinned:       r.pinned,
+	}
+}
+
+// newDiff describes how imported product changes the catalogue. Old product
+// is nil for new ones, reason is a validation error if any. Pinned prices
+// are kept regardless of validation.
+func newDiff(old, p *repo.Product, reason string) *pb.ProductDiff {
+	d := &pb.ProductDiff{
+		Name:     p.Name,
+		Kind:     pb.DiffKind_NEW,
+		NewPrice: newMoney(p.Price, p.Currency),
+		Reason:   reason,
+	}
+
+	if old != nil {
+		d.OldPrice = newMoney(old.Price, old.PriceCurrency())
+
+		switch {
+		case old.Price.Cmp(p.Price) == 0 && old.PriceCurrency() == p.Currency:
+			d.Kind = pb.DiffKind_UNCHANGED
+		case old.PriceCurrency() == p.Currency:
+			d.Kind = pb.DiffKind_CHANGED
+			d.ChangePercent = repo.ChangePercent(old.Price, p.Price)
+		default:
+			d.Kind = pb.DiffKind_CHANGED
+		}
+	}
+
+	if reason != "" {
+		d.Kind = pb.DiffKind_QUARANTINED
+	}
+
+	if old != nil && old.Pinned && d.Kind != pb.DiffKind_UNCHANGED {
+		d.Kind = pb.DiffKind_PINNED
+		d.Reason = "price is pinned"
+	}
+
+	return d
+}
+
+func (s *server) fetchData(ctx context.Context, f *feed) (*importResult, error) {
+	if f.url == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "url must be specified")
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", f.url, nil)
 	if err != nil {
-		return status.Errorf(codes.Internal, "build request: %v", err)
+		return nil, status.Errorf(codes.Internal, "build request: %v", err)
 	}
 
 	resp, err := s.hclient.Do(req)
 	if err != nil {
-		return status.Errorf(codes.Internal, "send request: %v", err)
+		return nil, status.Errorf(codes.Internal, "send request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return status.Errorf(codes.Internal, "wrong status: %d", resp.StatusCode)
+		return nil, status.Errorf(codes.Internal, "wrong status: %d", resp.StatusCode)
 	}
 
-	if err := s.readCSV(ctx, resp.Body); err != nil {
-		return status.Errorf(codes.Internal, "reading csv: %d", resp.StatusCode)
+	result, err := s.readCSV(ctx, resp.Body, f)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "reading csv: %d", resp.StatusCode)
 	}
 
-	return nil
+	return result, nil
 }
 
-func (s *server) readCSV(ctx context.Context, r io.Reader) error {
+func (s *server) readCSV(ctx context.Context, r io.Reader, f *feed) (*importResult, error) {
 	reader := csv.NewReader(r)
 	reader.Comma = ';'
 
 	// First read header
 	header, err := reader.Read()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Check format "PRODUCT NAME;PRICE"
-	if len(header) != 2 || header[0] != "PRODUCT NAME" || header[1] != "PRICE" {
-		return errors.New("invalid data format")
+	cols, err := parseHeader(header)
+	if err != nil {
+		return nil, err
 	}
 
-	now := time.Now().UTC()
+	var (
+		now    = time.Now().UTC()
+		result = &importResult{}
+		names  []string
+		rows   = make(map[string][]*feedRow)
+	)
 
-	for {
+	for num := int32(1); ; num++ {
 		row, err := reader.Read()
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		price, err := strconv.ParseFloat(row[1], 64)
+		price, err := repo.ParseAmount(row[1])
 		if err != nil {
-			return fmt.Errorf("%s: %w", row[0], err)
+			return nil, fmt.Errorf("%s: %w", row[0], err)
+		}
+
+		rowCurrency := f.currency
+		if cols.currency > 0 {
+			rowCurrency, err = normalizeCurrency(row[cols.currency], f.currency)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", row[0], err)
+			}
 		}
 
 		prod := repo.NewProduct()
 		prod.Name = row[0]
 		prod.Price = price
+		prod.Currency = rowCurrency
 		prod.UpdatedAt = now
 
-		if err := s.repo.SaveProduct(ctx, prod); err != nil {
+		if cols.sku > 0 {
+			prod.SKU = strings.TrimSpace(row[cols.sku])
+		}
+
+		if _, ok := rows[prod.Name]; !ok {
+			names = append(names, prod.Name)
+		}
+		rows[prod.Name] = append(rows[prod.Name], &feedRow{num: num, prod: prod})
+	}
+
+	// products are applied once in order of their first appearance
+	for _, name := range names {
+		prod, dup := resolveDuplicates(rows[name], f.duplicates)
+		if dup != nil {
+			result.duplicates = append(result.duplicates, dup)
+		}
+		if prod == nil {
+			continue
+		}
+
+		if err := s.importProduct(ctx, f, prod, result); err != nil {
+			return nil, err
+		}
+	}
+
+	// pinned, quarantined and rejected duplicates are seen in the feed too
+	if !f.dryRun {
+		if err := s.markSeen(ctx, names, now); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// columns holds positions of optional CSV columns, zero means absent.
+type columns struct {
+	currency int
+	sku      int
+}
+
+// parseHeader checks format "PRODUCT NAME;PRICE" followed by optional
+// "CURRENCY" and "SKU" columns in any order.
+func parseHeader(header []string) (*columns, error) {
+	if len(header) < 2 || header[0] != "PRODUCT NAME" || header[1] != "PRICE" {
+		return nil, errors.New("invalid data format")
+	}
+
+	cols := &columns{}
+	for i, name := range header[2:] {
+		switch {
+		case name == "CURRENCY" && cols.currency == 0:
+			cols.currency = i + 2
+		case name == "SKU" && cols.sku == 0:
+			cols.sku = i + 2
+		default:
+			return nil, errors.New("invalid data format")
+		}
+	}
+
+	return cols, nil
+}
+
+func (s *server) importProduct(ctx context.Context, f *feed, prod *repo.Product, result *importResult) error {
+	old, err := s.repo.FindByName(ctx, prod.Name)
+	if errors.Is(err, repo.ErrNotFound) {
+		old = nil
+	} else if err != nil {
+		return err
+	}
+
+	diff := newDiff(old, prod, s.rules.check(old, prod))
+
+	result.add(diff, f.dryRun && f.diff == nil)
+
+	if f.diff != nil {
+		if err := f.diff(diff); err != nil {
+			return err
+		}
+	}
+
+	if f.dryRun || diff.Kind == pb.DiffKind_PINNED {
+		return nil
+	}
+
+	// suspicious prices wait for review instead of being applied
+	if diff.Kind == pb.DiffKind_QUARANTINED {
+		q := &repo.Quarantined{
+			Name:      prod.Name,
+			Price:     prod.Price,
+			Currency:  prod.Currency,
+			Reason:    diff.Reason,
+			Source:    f.url,
+			CreatedAt: prod.UpdatedAt,
+		}
+
+		return s.repo.QuarantineProduct(ctx, q)
+	}
+
+	err = s.repo.SaveProduct(ctx, prod, repo.WithAudit(_importActor, f.url))
+	if errors.Is(err, repo.ErrPinned) {
+		// pinned after the product was read
+		return nil
+	}
+	if err != nil || diff.Kind == pb.DiffKind_UNCHANGED {
+		return err
+	}
+
+	if !f.alertsLoaded {
+		if f.alerts, err = s.alertRules(ctx); err != nil {
 			return err
 		}
+		f.alertsLoaded = true
 	}
 
-	return nil
+	return s.evaluateAlerts(ctx, f.alerts, prod.Name)
 }
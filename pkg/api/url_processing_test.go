@@ -3,13 +3,19 @@ package api
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestFetchData(t *testing.T) {
@@ -46,7 +52,8 @@ func TestFetchData(t *testing.T) {
 				repo:    repo.NewMongoRepo("productstore_test", conn),
 			}
 
-			r.NoError(s.fetchData(context.Background(), tc.URL))
+			_, err = s.fetchData(context.Background(), &feed{url: tc.URL, currency: repo.DefaultCurrency})
+			r.NoError(err)
 		})
 	}
 }
@@ -64,6 +71,10 @@ func TestReadCSV(t *testing.T) {
 			Name: "Phones",
 			Path: "testdata/iphones.csv",
 		},
+		{
+			Name: "Currencies",
+			Path: "testdata/currencies.csv",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -89,7 +100,376 @@ func TestReadCSV(t *testing.T) {
 			r.NoError(err)
 			defer file.Close()
 
-			r.NoError(s.readCSV(context.Background(), file))
+			_, err = s.readCSV(context.Background(), file, &feed{currency: repo.DefaultCurrency})
+			r.NoError(err)
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Header   []string
+		Expected *columns
+	}{
+		{
+			Name:     "Basic",
+			Header:   []string{"PRODUCT NAME", "PRICE"},
+			Expected: &columns{},
+		},
+		{
+			Name:     "Currency",
+			Header:   []string{"PRODUCT NAME", "PRICE", "CURRENCY"},
+			Expected: &columns{currency: 2},
+		},
+		{
+			Name:     "SKUFirst",
+			Header:   []string{"PRODUCT NAME", "PRICE", "SKU", "CURRENCY"},
+			Expected: &columns{currency: 3, sku: 2},
+		},
+		{
+			Name:   "Swapped",
+			Header: []string{"PRICE", "PRODUCT NAME"},
+		},
+		{
+			Name:   "Unknown",
+			Header: []string{"PRODUCT NAME", "PRICE", "COLOR"},
+		},
+		{
+			Name:   "Repeated",
+			Header: []string{"PRODUCT NAME", "PRICE", "SKU", "SKU"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			cols, err := parseHeader(tc.Header)
+			if tc.Expected == nil {
+				r.Error(err)
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Expected, cols)
+		})
+	}
+}
+
+func TestReadCSVQuarantine(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	s := &server{
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		rules:   Rules{MaxChangePercent: 50},
+	}
+
+	f := &feed{url: "testdata", currency: repo.DefaultCurrency}
+
+	result, err := s.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\niPhone 12 PRO;1099\n"), f)
+	r.NoError(err)
+	r.Equal(int32(0), result.quarantined)
+
+	// typo in the first row and non-positive price in the second one
+	result, err = s.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;9.99\niPhone 12 PRO;0\n"), f)
+	r.NoError(err)
+	r.Equal(int32(2), result.quarantined)
+
+	// the same rows are not duplicated in quarantine
+	result, err = s.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;9.99\n"), f)
+	r.NoError(err)
+	r.Equal(int32(1), result.quarantined)
+
+	prod, err := s.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("999", prod.Price.String())
+
+	list, err := s.ListQuarantined(ctx, &store.ListQuarantinedRequest{})
+	r.NoError(err)
+	r.Len(list.Products, 2)
+
+	for _, q := range list.Products {
+		r.Equal("testdata", q.Source)
+		r.NotEmpty(q.Reason)
+
+		switch q.Name {
+		case "iPhone 12":
+			_, err = s.ApproveQuarantined(ctx, &store.ApproveQuarantinedRequest{Id: q.Id})
+			r.NoError(err)
+		case "iPhone 12 PRO":
+			_, err = s.RejectQuarantined(ctx, &store.RejectQuarantinedRequest{Id: q.Id})
+			r.NoError(err)
+		}
+	}
+
+	prod, err = s.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("9.99", prod.Price.String())
+
+	prod, err = s.repo.FindByName(ctx, "iPhone 12 PRO")
+	r.NoError(err)
+	r.Equal("1099", prod.Price.String())
+
+	list, err = s.ListQuarantined(ctx, &store.ListQuarantinedRequest{})
+	r.NoError(err)
+	r.Empty(list.Products)
+
+	_, err = s.RejectQuarantined(ctx, &store.RejectQuarantinedRequest{Id: list.LastId})
+	r.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestNewDiff(t *testing.T) {
+	product := func(price, currency string) *repo.Product {
+		return repo.NewProduct(func(p *repo.Product) {
+			p.Name = "iPhone 12"
+			p.Price = repo.MustParseAmount(price)
+			p.Currency = currency
 		})
 	}
+
+	pinned := func(price, currency string) *repo.Product {
+		p := product(price, currency)
+		p.Pinned = true
+		return p
+	}
+
+	testCases := []struct {
+		Name    string
+		Old     *repo.Product
+		New     *repo.Product
+		Reason  string
+		Kind    store.DiffKind
+		Percent float64
+	}{
+		{
+			Name: "New",
+			New:  product("999", "USD"),
+			Kind: store.DiffKind_NEW,
+		},
+		{
+			Name: "Unchanged",
+			Old:  product("999", "USD"),
+			New:  product("999.00", "USD"),
+			Kind: store.DiffKind_UNCHANGED,
+		},
+		{
+			Name:    "Changed",
+			Old:     product("1000", "USD"),
+			New:     product("900", "USD"),
+			Kind:    store.DiffKind_CHANGED,
+			Percent: -10,
+		},
+		{
+			Name: "Currency",
+			Old:  product("999", "USD"),
+			New:  product("999", "EUR"),
+			Kind: store.DiffKind_CHANGED,
+		},
+		{
+			Name:    "Quarantined",
+			Old:     product("999", "USD"),
+			New:     product("9.99", "USD"),
+			Reason:  "price changed",
+			Kind:    store.DiffKind_QUARANTINED,
+			Percent: -99,
+		},
+		{
+			Name:    "Pinned",
+			Old:     pinned("1000", "USD"),
+			New:     product("900", "USD"),
+			Kind:    store.DiffKind_PINNED,
+			Percent: -10,
+		},
+		{
+			Name:    "PinnedQuarantined",
+			Old:     pinned("999", "USD"),
+			New:     product("9.99", "USD"),
+			Reason:  "price changed",
+			Kind:    store.DiffKind_PINNED,
+			Percent: -99,
+		},
+		{
+			Name: "PinnedUnchanged",
+			Old:  pinned("999", "USD"),
+			New:  product("999", "USD"),
+			Kind: store.DiffKind_UNCHANGED,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			d := newDiff(tc.Old, tc.New, tc.Reason)
+			r.Equal(tc.Kind, d.Kind)
+			r.Equal(tc.Percent, d.ChangePercent)
+			r.Equal(tc.New.Price.Units(), d.NewPrice.Units)
+
+			if tc.Old == nil {
+				r.Nil(d.OldPrice)
+			} else {
+				r.Equal(tc.Old.Currency, d.OldPrice.Currency)
+			}
+		})
+	}
+}
+
+func TestReadCSVDryRun(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	s := &server{
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+		rules:   Rules{MaxChangePercent: 50},
+	}
+
+	_, err = s.readCSV(ctx, strings.NewReader("PRODUCT NAME;PRICE\niPhone 12;999\niPhone 12 PRO;1099\niPhone 11;699\n"), &feed{currency: repo.DefaultCurrency})
+	r.NoError(err)
+
+	data := "PRODUCT NAME;PRICE\niPhone 12;899\niPhone 12 PRO;10.99\niPhone 11;699\niPhone 12 mini;699\n"
+
+	result, err := s.readCSV(ctx, strings.NewReader(data), &feed{currency: repo.DefaultCurrency, dryRun: true})
+	r.NoError(err)
+
+	resp := result.response()
+	r.Equal(int32(1), resp.Inserted)
+	r.Equal(int32(1), resp.Updated)
+	r.Equal(int32(1), resp.Unchanged)
+	r.Equal(int32(1), resp.Quarantined)
+	r.Len(resp.NewProducts, 1)
+	r.Equal("iPhone 12 mini", resp.NewProducts[0].Name)
+	r.Len(resp.PriceChanges, 1)
+	r.Equal("iPhone 12", resp.PriceChanges[0].Name)
+	r.InDelta(-10.01, resp.PriceChanges[0].ChangePercent, 0.01)
+	r.Len(resp.Rejected, 1)
+	r.Equal("iPhone 12 PRO", resp.Rejected[0].Name)
+
+	// nothing is written on dry run
+	_, err = s.repo.FindByName(ctx, "iPhone 12 mini")
+	r.Equal(repo.ErrNotFound, err)
+
+	prod, err := s.repo.FindByName(ctx, "iPhone 12")
+	r.NoError(err)
+	r.Equal("999", prod.Price.String())
+
+	quarantined, err := s.repo.ListQuarantined(ctx, nil)
+	r.NoError(err)
+	r.Empty(quarantined)
+}
+
+type previewStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	items []*store.FetchPreviewResponse
+}
+
+func (s *previewStream) Context() context.Context { return s.ctx }
+
+func (s *previewStream) Send(m *store.FetchPreviewResponse) error {
+	s.items = append(s.items, m)
+	return nil
+}
+
+func TestServerFetchPreview(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	ts := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer ts.Close()
+
+	s := &server{
+		timeout: _defaultTimeout,
+		hclient: ts.Client(),
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+	}
+
+	stream := &previewStream{ctx: ctx}
+	r.NoError(s.FetchPreview(&store.FetchRequest{Url: ts.URL + "/iphones.csv"}, stream))
+
+	// two new products followed by the summary
+	r.Len(stream.items, 3)
+	r.Equal(store.DiffKind_NEW, stream.items[0].GetDiff().Kind)
+	r.Equal(store.DiffKind_NEW, stream.items[1].GetDiff().Kind)
+
+	summary := stream.items[2].GetSummary()
+	r.NotNil(summary)
+	r.Equal(int32(2), summary.Inserted)
+	r.Empty(summary.NewProducts)
+
+	list, err := s.repo.ListProducts(ctx, &repo.ListOptions{})
+	r.NoError(err)
+	r.Empty(list)
+}
+
+func TestReadCSVDuplicates(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	s := &server{
+		timeout: _defaultTimeout,
+		hclient: &http.Client{},
+		repo:    repo.NewMongoRepo("productstore_test", conn),
+	}
+
+	file, err := os.Open("testdata/duplicates.csv")
+	r.NoError(err)
+	defer file.Close()
+
+	result, err := s.readCSV(ctx, file, &feed{currency: repo.DefaultCurrency, duplicates: store.DuplicatePolicy_REJECT_BOTH})
+	r.NoError(err)
+
+	resp := result.response()
+	r.Len(resp.Duplicates, 2)
+	r.Equal("iPhone 12", resp.Duplicates[0].Name)
+	r.Equal([]int32{1, 3}, resp.Duplicates[0].Rows)
+	r.Nil(resp.Duplicates[0].Chosen)
+	r.Equal("iPhone 11", resp.Duplicates[1].Name)
+	r.NotNil(resp.Duplicates[1].Chosen)
+	r.Equal(int32(2), resp.Inserted)
+
+	_, err = s.repo.FindByName(ctx, "iPhone 12")
+	r.Equal(repo.ErrNotFound, err)
+
+	// no spurious price change is recorded for the applied duplicate
+	prod, err := s.repo.FindByName(ctx, "iPhone 11")
+	r.NoError(err)
+	r.Empty(prod.Changes)
 }
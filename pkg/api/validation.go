@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+)
+
+// Rules holds price validation rules applied to imported rows. Rows which
+// violate any of them are quarantined instead of being saved. Zero values
+// disable corresponding checks, prices are compared in product currency.
+type Rules struct {
+	MinPrice         repo.Amount
+	MaxPrice         repo.Amount
+	MaxChangePercent float64
+	AllowNonPositive bool
+}
+
+// check returns the reason why new price can not be applied automatically,
+// empty string means the price is valid. Old product is nil for new ones.
+func (r *Rules) check(old, p *repo.Product) string {
+	if !r.AllowNonPositive && p.Price.Sign() <= 0 {
+		return fmt.Sprintf("non-positive price %s", p.Price)
+	}
+
+	if !r.MinPrice.IsZero() && p.Price.Cmp(r.MinPrice) < 0 {
+		return fmt.Sprintf("price %s is below minimum %s", p.Price, r.MinPrice)
+	}
+
+	if !r.MaxPrice.IsZero() && p.Price.Cmp(r.MaxPrice) > 0 {
+		return fmt.Sprintf("price %s is above maximum %s", p.Price, r.MaxPrice)
+	}
+
+	if r.MaxChangePercent > 0 && old != nil && old.PriceCurrency() == p.Currency && old.Price.Sign() > 0 {
+		change := repo.ChangePercent(old.Price, p.Price)
+		if change > r.MaxChangePercent || -change > r.MaxChangePercent {
+			return fmt.Sprintf("price changed by %.2f%% from %s to %s", change, old.Price, p.Price)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRulesCheck(t *testing.T) {
+	product := func(price, currency string) *repo.Product {
+		return repo.NewProduct(func(p *repo.Product) {
+			p.Name = "Apple iPhone 12"
+			p.Price = repo.MustParseAmount(price)
+			p.Currency = currency
+		})
+	}
+
+	testCases := []struct {
+		Name    string
+		Rules   Rules
+		Old     *repo.Product
+		New     *repo.Product
+		Invalid bool
+	}{
+		{
+			Name: "Valid",
+			New:  product("999", "USD"),
+		},
+		{
+			Name:    "Zero",
+			New:     product("0", "USD"),
+			Invalid: true,
+		},
+		{
+			Name:  "AllowNonPositive",
+			Rules: Rules{AllowNonPositive: true},
+			New:   product("0", "USD"),
+		},
+		{
+			Name:    "BelowMin",
+			Rules:   Rules{MinPrice: repo.MustParseAmount("10")},
+			New:     product("9.99", "USD"),
+			Invalid: true,
+		},
+		{
+			Name:    "AboveMax",
+			Rules:   Rules{MaxPrice: repo.MustParseAmount("5000")},
+			New:     product("5000.01", "USD"),
+			Invalid: true,
+		},
+		{
+			Name:    "Drop",
+			Rules:   Rules{MaxChangePercent: 50},
+			Old:     product("999", "USD"),
+			New:     product("9.99", "USD"),
+			Invalid: true,
+		},
+		{
+			Name:    "Rise",
+			Rules:   Rules{MaxChangePercent: 50},
+			Old:     product("9.99", "USD"),
+			New:     product("999", "USD"),
+			Invalid: true,
+		},
+		{
+			Name:  "WithinChange",
+			Rules: Rules{MaxChangePercent: 50},
+			Old:   product("999", "USD"),
+			New:   product("899", "USD"),
+		},
+		{
+			Name:  "CurrencyChange",
+			Rules: Rules{MaxChangePercent: 50},
+			Old:   product("999", "USD"),
+			New:   product("420000", "KZT"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			reason := tc.Rules.check(tc.Old, tc.New)
+			if tc.Invalid {
+				r.NotEmpty(reason)
+				return
+			}
+
+			r.Empty(reason)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) Watch(in *pb.WatchRequest, stream pb.Store_WatchServer) error {
+	w, ok := s.repo.(repo.Watcher)
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "watching is not supported by repository")
+	}
+
+	opts, err := buildWatchOptions(in)
+	if err != nil {
+		return err
+	}
+
+	err = w.WatchProducts(stream.Context(), opts, func(e *repo.ProductEvent) error {
+		return stream.Send(newWatchResponse(e))
+	})
+	switch {
+	case stream.Context().Err() != nil:
+		return status.FromContextError(stream.Context().Err()).Err()
+	case errors.Is(err, repo.ErrHistoryLost):
+		return status.Errorf(codes.OutOfRange, "resume token has expired")
+	case err != nil:
+		return status.Errorf(codes.Internal, "could not watch products")
+	}
+
+	return nil
+}
+
+func buildWatchOptions(in *pb.WatchRequest) (*repo.WatchOptions, error) {
+	filter, err := buildFilter(&pb.Filter{
+		NamePrefix: in.NamePrefix,
+		MinPrice:   in.MinPrice,
+		MaxPrice:   in.MaxPrice,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &repo.WatchOptions{Filter: filter}
+
+	if in.ResumeToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(in.ResumeToken)
+		if err != nil || bson.Raw(token).Validate() != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid resume token")
+		}
+
+		opts.ResumeAfter = token
+	}
+
+	return opts, nil
+}
+
+func newWatchResponse(e *repo.ProductEvent) *pb.WatchResponse {
+	p := &e.Product
+
+	resp := &pb.WatchResponse{
+		Product:     newProduct(p, p.Price, p.PriceCurrency()),
+		Created:     e.Created,
+		ResumeToken: base64.RawURLEncoding.EncodeToString(e.Token),
+	}
+
+	if e.Change != nil {
+		resp.OldPrice = newMoney(e.Change.Price, e.Change.PriceCurrency())
+		resp.Actor = e.Change.Actor
+		resp.Reason = e.Change.Reason
+	}
+
+	return resp
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBuildWatchOptions(t *testing.T) {
+	token, err := bson.Marshal(bson.M{"_data": "8260"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name    string
+		Request *store.WatchRequest
+		Code    codes.Code
+	}{
+		{
+			Name:    "Empty",
+			Request: &store.WatchRequest{},
+		},
+		{
+			Name: "Filter",
+			Request: &store.WatchRequest{
+				NamePrefix:  "Apple",
+				MinPrice:    &store.Money{Currency: "USD", Units: 100},
+				MaxPrice:    &store.Money{Units: 1000},
+				ResumeToken: base64.RawURLEncoding.EncodeToString(token),
+			},
+		},
+		{
+			Name:    "InvalidPriceRange",
+			Request: &store.WatchRequest{MinPrice: &store.Money{Units: 1000}, MaxPrice: &store.Money{Units: 100}},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "InvalidToken",
+			Request: &store.WatchRequest{ResumeToken: "???"},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "InvalidDocument",
+			Request: &store.WatchRequest{ResumeToken: base64.RawURLEncoding.EncodeToString([]byte("token"))},
+			Code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			opts, err := buildWatchOptions(tc.Request)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Request.NamePrefix, opts.Filter.NamePrefix)
+			if tc.Request.ResumeToken != "" {
+				r.Equal(token, opts.ResumeAfter)
+			}
+		})
+	}
+}
+
+func TestNewWatchResponse(t *testing.T) {
+	r := require.New(t)
+
+	e := &repo.ProductEvent{
+		Token: []byte{1, 2},
+		Product: repo.Product{
+			Name:  "Apple iPhone 12",
+			Price: repo.MustParseAmount("899.99"),
+		},
+		Change: &repo.Change{Price: repo.MustParseAmount("999"), Actor: "admin", Reason: "sale"},
+	}
+
+	resp := newWatchResponse(e)
+	r.Equal("Apple iPhone 12", resp.Product.Name)
+	r.Equal(&store.Money{Currency: "USD", Units: 899, Nanos: 990000000}, resp.Product.Amount)
+	r.Equal(&store.Money{Currency: "USD", Units: 999}, resp.OldPrice)
+	r.Equal("admin", resp.Actor)
+	r.Equal("sale", resp.Reason)
+	r.Equal("AQI", resp.ResumeToken)
+	r.False(resp.Created)
+}
+
+func TestServerWatchUnsupported(t *testing.T) {
+	srv := &server{repo: struct{ repo.Repository }{}}
+
+	err := srv.Watch(&store.WatchRequest{}, nil)
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
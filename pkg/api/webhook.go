@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	pb "github.com/danikarik/product-storage/pkg/store"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *server) webhooks() (repo.Webhooks, error) {
+	w, ok := s.repo.(repo.Webhooks)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "webhooks are not supported by repository")
+	}
+
+	return w, nil
+}
+
+func (s *server) CreateSubscription(ctx context.Context, in *pb.CreateSubscriptionRequest) (*pb.CreateSubscriptionResponse, error) {
+	w, err := s.webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	sub, err := buildSubscription(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.SaveSubscription(ctx, sub); err != nil {
+		return nil, status.Errorf(codes.Internal, "could not save subscription")
+	}
+
+	return &pb.CreateSubscriptionResponse{
+		Subscription: newSubscription(sub),
+		Secret:       sub.Secret,
+	}, nil
+}
+
+func buildSubscription(in *pb.CreateSubscriptionRequest) (*repo.Subscription, error) {
+	u, err := url.Parse(in.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid webhook url")
+	}
+
+	filter, err := buildFilter(&pb.Filter{
+		NamePrefix: in.NamePrefix,
+		MinPrice:   in.MinPrice,
+		MaxPrice:   in.MaxPrice,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret := in.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, status.Errorf(codes.Internal, "could not generate secret")
+		}
+
+		secret = hex.EncodeToString(key)
+	}
+
+	return &repo.Subscription{
+		URL:    u.String(),
+		Secret: secret,
+		Filter: repo.SubscriptionFilter{
+			NamePrefix: filter.NamePrefix,
+			MinPrice:   filter.MinPrice,
+			MaxPrice:   filter.MaxPrice,
+			Currency:   filter.Currency,
+			AlertOwner: in.AlertOwner,
+		},
+	}, nil
+}
+
+func newSubscription(sub *repo.Subscription) *pb.Subscription {
+	resp := &pb.Subscription{
+		Id:         sub.ID.Hex(),
+		Url:        sub.URL,
+		NamePrefix: sub.Filter.NamePrefix,
+		CreatedAt:  newTimestamp(sub.CreatedAt),
+		AlertOwner: sub.Filter.AlertOwner,
+	}
+
+	if sub.Filter.MinPrice != nil {
+		resp.MinPrice = newMoney(*sub.Filter.MinPrice, sub.Filter.Currency)
+	}
+	if sub.Filter.MaxPrice != nil {
+		resp.MaxPrice = newMoney(*sub.Filter.MaxPrice, sub.Filter.Currency)
+	}
+
+	return resp
+}
+
+func (s *server) DeleteSubscription(ctx context.Context, in *pb.DeleteSubscriptionRequest) (*pb.DeleteSubscriptionResponse, error) {
+	w, err := s.webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	err = w.DeleteSubscription(ctx, id)
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "subscription not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not delete subscription")
+	}
+
+	return &pb.DeleteSubscriptionResponse{}, nil
+}
+
+func (s *server) ListSubscriptions(ctx context.Context, in *pb.ListSubscriptionsRequest) (*pb.ListSubscriptionsResponse, error) {
+	w, err := s.webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	subs, err := w.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve subscriptions")
+	}
+
+	resp := &pb.ListSubscriptionsResponse{
+		Subscriptions: make([]*pb.Subscription, 0, len(subs)),
+	}
+
+	for i := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, newSubscription(&subs[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *server) ListDeliveries(ctx context.Context, in *pb.ListDeliveriesRequest) (*pb.ListDeliveriesResponse, error) {
+	w, err := s.webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &repo.DeliveryFilter{}
+	if in.SubscriptionId != "" {
+		filter.SubscriptionID, err = primitive.ObjectIDFromHex(in.SubscriptionId)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid subscription id")
+		}
+	}
+
+	for _, st := range in.Statuses {
+		filter.Statuses = append(filter.Statuses, repo.DeliveryStatus(st))
+	}
+
+	paging := &repo.Pager{}
+	if in.Paging != nil {
+		paging.Limit = in.Paging.Limit
+
+		if in.Paging.LastId != "" {
+			id, err := primitive.ObjectIDFromHex(in.Paging.LastId)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+			}
+
+			paging.LastID = id
+		}
+	}
+
+	ds, err := w.ListDeliveries(ctx, filter, paging)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve deliveries")
+	}
+
+	resp := &pb.ListDeliveriesResponse{
+		LastId:     "",
+		Deliveries: make([]*pb.Delivery, 0, len(ds)),
+	}
+
+	if len(ds) > 0 {
+		resp.LastId = ds[len(ds)-1].ID.Hex()
+	}
+
+	for i := range ds {
+		resp.Deliveries = append(resp.Deliveries, newDelivery(&ds[i]))
+	}
+
+	return resp, nil
+}
+
+func (s *server) RetryDelivery(ctx context.Context, in *pb.RetryDeliveryRequest) (*pb.RetryDeliveryResponse, error) {
+	w, err := s.webhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := primitive.ObjectIDFromHex(in.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid object id")
+	}
+
+	err = w.RetryDelivery(ctx, id, time.Now().UTC())
+	if errors.Is(err, repo.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "dead delivery not found")
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retry delivery")
+	}
+
+	d, err := w.FindDelivery(ctx, id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not retrieve delivery")
+	}
+
+	return &pb.RetryDeliveryResponse{Delivery: newDelivery(d)}, nil
+}
+
+func newDelivery(d *repo.Delivery) *pb.Delivery {
+	resp := &pb.Delivery{
+		Id:             d.ID.Hex(),
+		SubscriptionId: d.SubscriptionID.Hex(),
+		EventId:        d.EventID.Hex(),
+		Status:         pb.DeliveryStatus(d.Status),
+		Attempts:       make([]*pb.DeliveryAttempt, 0, len(d.Attempts)),
+		CreatedAt:      newTimestamp(d.CreatedAt),
+	}
+
+	if d.Status == repo.DeliveryPending {
+		resp.NextAttemptAt = newTimestamp(d.NextAttemptAt)
+	}
+	if d.DeliveredAt != nil {
+		resp.DeliveredAt = newTimestamp(*d.DeliveredAt)
+	}
+
+	for _, a := range d.Attempts {
+		resp.Attempts = append(resp.Attempts, &pb.DeliveryAttempt{
+			AttemptedAt: newTimestamp(a.AttemptedAt),
+			StatusCode:  int32(a.StatusCode),
+			Error:       a.Error,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/danikarik/product-storage/pkg/store"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBuildSubscription(t *testing.T) {
+	testCases := []struct {
+		Name    string
+		Request *store.CreateSubscriptionRequest
+		Code    codes.Code
+	}{
+		{
+			Name: "Valid",
+			Request: &store.CreateSubscriptionRequest{
+				Url:        "https://partner.example.com/hooks/prices",
+				NamePrefix: "Apple",
+				MinPrice:   &store.Money{Currency: "USD", Units: 100},
+				Secret:     "secret",
+			},
+		},
+		{
+			Name:    "GeneratedSecret",
+			Request: &store.CreateSubscriptionRequest{Url: "http://localhost:8080"},
+		},
+		{
+			Name:    "MissingURL",
+			Request: &store.CreateSubscriptionRequest{},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "InvalidScheme",
+			Request: &store.CreateSubscriptionRequest{Url: "ftp://example.com"},
+			Code:    codes.InvalidArgument,
+		},
+		{
+			Name:    "InvalidPrice",
+			Request: &store.CreateSubscriptionRequest{Url: "https://example.com", MaxPrice: &store.Money{Units: 1, Nanos: -1}},
+			Code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			sub, err := buildSubscription(tc.Request)
+			if tc.Code != codes.OK {
+				r.Equal(tc.Code, status.Code(err))
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Request.Url, sub.URL)
+			r.Equal(tc.Request.NamePrefix, sub.Filter.NamePrefix)
+
+			if tc.Request.Secret != "" {
+				r.Equal(tc.Request.Secret, sub.Secret)
+			} else {
+				r.Len(sub.Secret, 64)
+			}
+
+			if tc.Request.MinPrice != nil {
+				r.Equal("100", sub.Filter.MinPrice.String())
+				r.Equal("USD", sub.Filter.Currency)
+				r.Equal(tc.Request.MinPrice, newSubscription(sub).MinPrice)
+			}
+		})
+	}
+}
+
+func TestNewDelivery(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		now = time.Now().UTC()
+		d   = &repo.Delivery{
+			ID:             primitive.NewObjectID(),
+			SubscriptionID: primitive.NewObjectID(),
+			EventID:        primitive.NewObjectID(),
+			Status:         repo.DeliveryDead,
+			Attempts:       []repo.DeliveryAttempt{{AttemptedAt: now, Error: "connection refused"}},
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		}
+	)
+
+	resp := newDelivery(d)
+	r.Equal(store.DeliveryStatus_DEAD, resp.Status)
+	r.Equal(d.EventID.Hex(), resp.EventId)
+	r.Nil(resp.NextAttemptAt)
+	r.Nil(resp.DeliveredAt)
+	r.Len(resp.Attempts, 1)
+	r.Zero(resp.Attempts[0].StatusCode)
+	r.Equal("connection refused", resp.Attempts[0].Error)
+}
+
+func TestServerWebhooksUnsupported(t *testing.T) {
+	var (
+		ctx = context.Background()
+		srv = &server{repo: struct{ repo.Repository }{}}
+	)
+
+	_, err := srv.ListSubscriptions(ctx, &store.ListSubscriptionsRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
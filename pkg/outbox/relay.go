@@ -0,0 +1,184 @@
+// Package outbox relays events recorded by repository to external systems.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+)
+
+// Sink delivers events to external system. Events are delivered at least
+// once, so sinks may receive duplicates and should tell them by event id.
+type Sink interface {
+	// Name identifies the sink in delivery state of events, it must not be
+	// changed while there are undelivered events.
+	Name() string
+	Deliver(ctx context.Context, e *repo.OutboxEvent) error
+}
+
+// Options holds relay configuration, zero values are replaced by defaults.
+type Options struct {
+	// Interval between polls of the outbox.
+	Interval time.Duration
+	// BatchSize limits number of events claimed at once.
+	BatchSize int
+	// Lease is time given to deliver claimed events before other relays
+	// can claim them.
+	Lease time.Duration
+	// Failed deliveries are retried with exponential backoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnError is called with errors which do not stop the relay.
+	OnError func(error)
+}
+
+const (
+	_defaultInterval   = time.Second
+	_defaultBatchSize  = 100
+	_defaultLease      = time.Minute
+	_defaultMinBackoff = time.Second
+	_defaultMaxBackoff = time.Hour
+)
+
+// Relay delivers events from the outbox to all the sinks, event is removed
+// from the outbox once every sink has received it.
+type Relay struct {
+	store repo.Outbox
+	sinks []Sink
+	opts  Options
+	now   func() time.Time
+}
+
+// NewRelay returns relay of the outbox events.
+func NewRelay(store repo.Outbox, sinks []Sink, opts *Options) *Relay {
+	r := &Relay{
+		store: store,
+		sinks: sinks,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+
+	if opts != nil {
+		r.opts = *opts
+	}
+
+	if r.opts.Interval <= 0 {
+		r.opts.Interval = _defaultInterval
+	}
+	if r.opts.BatchSize <= 0 {
+		r.opts.BatchSize = _defaultBatchSize
+	}
+	if r.opts.Lease <= 0 {
+		r.opts.Lease = _defaultLease
+	}
+	if r.opts.MinBackoff <= 0 {
+		r.opts.MinBackoff = _defaultMinBackoff
+	}
+	if r.opts.MaxBackoff < r.opts.MinBackoff {
+		r.opts.MaxBackoff = _defaultMaxBackoff
+	}
+	if r.opts.OnError == nil {
+		r.opts.OnError = func(error) {}
+	}
+
+	return r
+}
+
+// Run polls the outbox until context is done.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			r.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush delivers all the events due at the moment, it returns number of
+// events delivered to every sink. Events failed to be delivered are
+// scheduled for retry. If the outbox can not be updated, claimed events are
+// delivered again when their lease expires.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	completed := 0
+
+	for {
+		events, err := r.store.ClaimEvents(ctx, r.now(), r.opts.Lease, r.opts.BatchSize)
+		if err != nil {
+			return completed, fmt.Errorf("claim events: %w", err)
+		}
+
+		for i := range events {
+			done, err := r.deliver(ctx, &events[i])
+			if err != nil {
+				return completed, err
+			}
+			if done {
+				completed++
+			}
+		}
+
+		// claimed and retried events are not due anymore
+		if len(events) < r.opts.BatchSize {
+			return completed, nil
+		}
+	}
+}
+
+func (r *Relay) deliver(ctx context.Context, e *repo.OutboxEvent) (bool, error) {
+	var failed []string
+
+	for _, s := range r.sinks {
+		if e.IsDelivered(s.Name()) {
+			continue
+		}
+
+		if err := s.Deliver(ctx, e); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s.Name(), err))
+			continue
+		}
+
+		if err := r.store.MarkDelivered(ctx, e.ID, s.Name()); err != nil {
+			return false, fmt.Errorf("mark event %s delivered: %w", e.ID.Hex(), err)
+		}
+	}
+
+	if len(failed) > 0 {
+		err := r.store.RetryEvent(ctx, e.ID, r.now().Add(Backoff(r.opts.MinBackoff, r.opts.MaxBackoff, e.Attempts)), strings.Join(failed, "; "))
+		if err != nil {
+			return false, fmt.Errorf("retry event %s: %w", e.ID.Hex(), err)
+		}
+
+		return false, nil
+	}
+
+	if err := r.store.CompleteEvent(ctx, e.ID); err != nil {
+		return false, fmt.Errorf("complete event %s: %w", e.ID.Hex(), err)
+	}
+
+	return true, nil
+}
+
+// Backoff returns delay before the next attempt, it starts from min and is
+// doubled with every failed attempt up to max.
+func Backoff(min, max time.Duration, attempts int) time.Duration {
+	d := min
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
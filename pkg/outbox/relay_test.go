@@ -0,0 +1,184 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryOutbox keeps events in memory the same way as repository does.
+type memoryOutbox struct {
+	events map[primitive.ObjectID]*repo.OutboxEvent
+	fail   error
+}
+
+func newMemoryOutbox(events ...repo.OutboxEvent) *memoryOutbox {
+	o := &memoryOutbox{events: make(map[primitive.ObjectID]*repo.OutboxEvent)}
+	for i := range events {
+		o.events[events[i].ID] = &events[i]
+	}
+	return o
+}
+
+func (o *memoryOutbox) ClaimEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repo.OutboxEvent, error) {
+	var due []*repo.OutboxEvent
+	for _, e := range o.events {
+		if !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].ID.Hex() < due[j].ID.Hex() })
+
+	var claimed []repo.OutboxEvent
+	for i := 0; i < len(due) && i < limit; i++ {
+		due[i].NextAttemptAt = now.Add(lease)
+		due[i].Attempts++
+		claimed = append(claimed, *due[i])
+	}
+
+	return claimed, nil
+}
+
+func (o *memoryOutbox) MarkDelivered(ctx context.Context, id primitive.ObjectID, sink string) error {
+	if o.fail != nil {
+		return o.fail
+	}
+	o.events[id].Delivered = append(o.events[id].Delivered, sink)
+	return nil
+}
+
+func (o *memoryOutbox) RetryEvent(ctx context.Context, id primitive.ObjectID, at time.Time, reason string) error {
+	o.events[id].NextAttemptAt = at
+	o.events[id].LastError = reason
+	return nil
+}
+
+func (o *memoryOutbox) CompleteEvent(ctx context.Context, id primitive.ObjectID) error {
+	delete(o.events, id)
+	return nil
+}
+
+// memorySink records delivered events, it fails while failures are left.
+type memorySink struct {
+	name      string
+	failures  int
+	delivered []primitive.ObjectID
+}
+
+func (s *memorySink) Name() string { return s.name }
+
+func (s *memorySink) Deliver(ctx context.Context, e *repo.OutboxEvent) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+
+	s.delivered = append(s.delivered, e.ID)
+	return nil
+}
+
+func testEvents(n int, at time.Time) []repo.OutboxEvent {
+	events := make([]repo.OutboxEvent, n)
+	for i := range events {
+		events[i] = repo.OutboxEvent{
+			ID:            primitive.NewObjectID(),
+			Name:          "Apple iPhone 12",
+			Price:         repo.MustParseAmount("999"),
+			NextAttemptAt: at,
+		}
+	}
+	return events
+}
+
+func TestRelayFlush(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx    = context.Background()
+		now    = time.Now().UTC()
+		events = testEvents(3, now)
+		store  = newMemoryOutbox(events...)
+		stable = &memorySink{name: "stable"}
+		flaky  = &memorySink{name: "flaky", failures: 2}
+		relay  = NewRelay(store, []Sink{stable, flaky}, &Options{BatchSize: 2, MinBackoff: time.Second})
+	)
+
+	relay.now = func() time.Time { return now }
+
+	// flaky sink fails with the first two events
+	n, err := relay.Flush(ctx)
+	r.NoError(err)
+	r.Equal(1, n)
+	r.Len(stable.delivered, 3)
+	r.Len(flaky.delivered, 1)
+	r.Len(store.events, 2)
+
+	for _, e := range store.events {
+		r.Equal([]string{"stable"}, e.Delivered)
+		r.Equal("flaky: unavailable", e.LastError)
+		r.Equal(now.Add(time.Second), e.NextAttemptAt)
+	}
+
+	// nothing is due before backoff
+	n, err = relay.Flush(ctx)
+	r.NoError(err)
+	r.Zero(n)
+
+	now = now.Add(time.Second)
+
+	// retries are delivered to the failed sink only
+	n, err = relay.Flush(ctx)
+	r.NoError(err)
+	r.Equal(2, n)
+	r.Len(stable.delivered, 3)
+	r.Len(flaky.delivered, 3)
+	r.Empty(store.events)
+}
+
+func TestRelayLease(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx   = context.Background()
+		now   = time.Now().UTC()
+		store = newMemoryOutbox(testEvents(1, now)...)
+		sink  = &memorySink{name: "sink"}
+		relay = NewRelay(store, []Sink{sink}, &Options{Lease: time.Minute})
+	)
+
+	relay.now = func() time.Time { return now }
+
+	// delivery can not be recorded, so event is delivered again after lease
+	store.fail = errors.New("connection lost")
+
+	_, err := relay.Flush(ctx)
+	r.Error(err)
+	r.Len(sink.delivered, 1)
+
+	store.fail = nil
+
+	n, err := relay.Flush(ctx)
+	r.NoError(err)
+	r.Zero(n)
+
+	now = now.Add(time.Minute)
+
+	n, err = relay.Flush(ctx)
+	r.NoError(err)
+	r.Equal(1, n)
+	r.Len(sink.delivered, 2)
+	r.Equal(sink.delivered[0], sink.delivered[1])
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, expected := range []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		require.Equal(t, expected, Backoff(time.Second, 5*time.Second, attempts))
+	}
+}
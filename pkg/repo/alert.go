@@ -0,0 +1,289 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AlertKind tells what price movement triggers the alert.
+type AlertKind int
+
+const (
+	// AlertBelow fires when price drops below the threshold.
+	AlertBelow AlertKind = iota
+	// AlertAbove fires when price rises above the threshold.
+	AlertAbove
+	// AlertChangePercent fires when price changes by at least the percent
+	// at once, negative percent watches drops and positive one rises.
+	AlertChangePercent
+)
+
+// AlertRule watches prices of products matched by name or name prefix.
+type AlertRule struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Owner      string             `bson:"owner"`
+	Name       string             `bson:"name,omitempty"`
+	NamePrefix string             `bson:"name_prefix,omitempty"`
+	Kind       AlertKind          `bson:"kind"`
+	// Threshold is compared with prices in Currency, products priced in
+	// other currencies are ignored.
+	Threshold Amount  `bson:"threshold"`
+	Currency  string  `bson:"currency,omitempty"`
+	Percent   float64 `bson:"percent,omitempty"`
+	// CreatedAt is set by SaveAlertRule.
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// Matches reports whether rule watches the product.
+func (r *AlertRule) Matches(p *Product) bool {
+	if r.Name != "" && r.Name != p.Name {
+		return false
+	}
+
+	return strings.HasPrefix(p.Name, r.NamePrefix)
+}
+
+// Evaluate returns alert if the last price change of the product crosses
+// the rule threshold. Product without changes crosses threshold from the
+// unknown price. Alerts of the same crossing share the sequence number.
+func (r *AlertRule) Evaluate(p *Product) *TriggeredAlert {
+	if !r.Matches(p) {
+		return nil
+	}
+
+	var (
+		price    = p.Price
+		currency = p.PriceCurrency()
+		prev     *Change
+	)
+
+	if len(p.Changes) > 0 {
+		prev = &p.Changes[len(p.Changes)-1]
+	}
+
+	// previous price in other currency is not comparable
+	comparable := prev != nil && prev.PriceCurrency() == currency
+
+	var fired bool
+	switch r.Kind {
+	case AlertBelow:
+		fired = currency == r.Currency && price.Cmp(r.Threshold) < 0 &&
+			(!comparable || prev.Price.Cmp(r.Threshold) >= 0)
+	case AlertAbove:
+		fired = currency == r.Currency && price.Cmp(r.Threshold) > 0 &&
+			(!comparable || prev.Price.Cmp(r.Threshold) <= 0)
+	case AlertChangePercent:
+		if comparable {
+			percent := ChangePercent(prev.Price, price)
+			fired = (r.Percent < 0 && percent <= r.Percent) || (r.Percent > 0 && percent >= r.Percent)
+		}
+	}
+
+	if !fired {
+		return nil
+	}
+
+	a := &TriggeredAlert{
+		RuleID:    r.ID,
+		Owner:     r.Owner,
+		ProductID: p.ID,
+		Name:      p.Name,
+		Kind:      r.Kind,
+		Price:     price,
+		Currency:  currency,
+		Seq:       int64(len(p.Changes)),
+	}
+
+	if comparable {
+		a.OldPrice = &prev.Price
+		a.ChangePercent = ChangePercent(prev.Price, price)
+	}
+
+	return a
+}
+
+// TriggeredAlert is a record of the rule fired by price change.
+type TriggeredAlert struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	RuleID    primitive.ObjectID `bson:"rule_id" json:"ruleId"`
+	Owner     string             `bson:"owner" json:"owner"`
+	ProductID primitive.ObjectID `bson:"product_id" json:"productId"`
+	Name      string             `bson:"name" json:"name"`
+	Kind      AlertKind          `bson:"kind" json:"kind"`
+	Price     Amount             `bson:"price" json:"price"`
+	Currency  string             `bson:"currency" json:"currency"`
+	// OldPrice is nil if the previous price is unknown or in other currency.
+	OldPrice      *Amount `bson:"old_price,omitempty" json:"oldPrice,omitempty"`
+	ChangePercent float64 `bson:"change_percent,omitempty" json:"changePercent,omitempty"`
+	// Seq is a number of price changes of the product at the crossing.
+	Seq         int64     `bson:"seq" json:"seq"`
+	TriggeredAt time.Time `bson:"triggered_at" json:"triggeredAt"`
+}
+
+// AlertFilter restricts listed alerts, zero values are ignored.
+type AlertFilter struct {
+	Owner  string
+	RuleID primitive.ObjectID
+}
+
+// Alerts is implemented by repositories which keep price alert rules.
+type Alerts interface {
+	SaveAlertRule(ctx context.Context, r *AlertRule) error
+	DeleteAlertRule(ctx context.Context, id primitive.ObjectID) error
+	ListAlertRules(ctx context.Context, owner string) ([]AlertRule, error)
+	// TriggerAlert records alert unless it was recorded for the same
+	// crossing already, it reports whether alert was recorded. Alerts are
+	// written to the outbox as well if it is enabled.
+	TriggerAlert(ctx context.Context, a *TriggeredAlert) (bool, error)
+	ListTriggeredAlerts(ctx context.Context, filter *AlertFilter, paging *Pager) ([]TriggeredAlert, error)
+}
+
+func (m *mongoRepo) SaveAlertRule(ctx context.Context, r *AlertRule) error {
+	if r == nil || r.Owner == "" {
+		return errInvalidData
+	}
+
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := m.db().Collection("alert_rules").ReplaceOne(ctx, bson.M{"_id": r.ID}, r, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *mongoRepo) DeleteAlertRule(ctx context.Context, id primitive.ObjectID) error {
+	res, err := m.db().Collection("alert_rules").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (m *mongoRepo) ListAlertRules(ctx context.Context, owner string) ([]AlertRule, error) {
+	filter := bson.M{}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+
+	cursor, err := m.db().Collection("alert_rules").Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []AlertRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (m *mongoRepo) TriggerAlert(ctx context.Context, a *TriggeredAlert) (bool, error) {
+	if a == nil {
+		return false, errInvalidData
+	}
+
+	if a.ID.IsZero() {
+		a.ID = primitive.NewObjectID()
+	}
+	if a.TriggeredAt.IsZero() {
+		a.TriggeredAt = time.Now().UTC()
+	}
+
+	if !m.outbox {
+		return m.insertAlert(ctx, a)
+	}
+
+	sess, err := m.client.StartSession()
+	if err != nil {
+		return false, err
+	}
+	defer sess.EndSession(ctx)
+
+	// alert and its event are written atomically
+	inserted, err := sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		ok, err := m.insertAlert(sc, a)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		_, err = m.db().Collection("outbox").InsertOne(sc, newAlertEvent(a))
+		return true, err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return inserted.(bool), nil
+}
+
+// insertAlert inserts alert unless the same crossing is recorded, which is
+// guarded by unique index.
+func (m *mongoRepo) insertAlert(ctx context.Context, a *TriggeredAlert) (bool, error) {
+	var (
+		filter = bson.M{"rule_id": a.RuleID, "product_id": a.ProductID, "seq": a.Seq}
+		update = bson.M{"$setOnInsert": a}
+	)
+
+	res, err := m.db().Collection("alerts").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if isDuplicateKey(err) {
+		// concurrent upsert of the same crossing
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return res.UpsertedCount > 0, nil
+}
+
+func (m *mongoRepo) ListTriggeredAlerts(ctx context.Context, f *AlertFilter, paging *Pager) ([]TriggeredAlert, error) {
+	if f == nil {
+		f = &AlertFilter{}
+	}
+	if paging == nil {
+		paging = &Pager{}
+	}
+	if paging.Limit == 0 {
+		paging.Limit = 10
+	}
+
+	filter := bson.M{}
+	if f.Owner != "" {
+		filter["owner"] = f.Owner
+	}
+	if !f.RuleID.IsZero() {
+		filter["rule_id"] = f.RuleID
+	}
+	if !paging.LastID.IsZero() {
+		filter["_id"] = bson.M{"$gt": paging.LastID}
+	}
+
+	fopts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(paging.Limit)
+
+	cursor, err := m.db().Collection("alerts").Find(ctx, filter, fopts)
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []TriggeredAlert
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestAlertRuleEvaluate(t *testing.T) {
+	product := func(price string, history ...string) *Product {
+		p := &Product{Name: "Apple iPhone 12", Price: MustParseAmount(price), Currency: "USD"}
+		for _, h := range history {
+			p.Changes = append(p.Changes, Change{Price: MustParseAmount(h), Currency: "USD"})
+		}
+		return p
+	}
+
+	var (
+		below   = AlertRule{Name: "Apple iPhone 12", Kind: AlertBelow, Threshold: MustParseAmount("900"), Currency: "USD"}
+		above   = AlertRule{NamePrefix: "Apple", Kind: AlertAbove, Threshold: MustParseAmount("1000"), Currency: "USD"}
+		drop    = AlertRule{NamePrefix: "Apple", Kind: AlertChangePercent, Percent: -10}
+		rise    = AlertRule{NamePrefix: "Apple", Kind: AlertChangePercent, Percent: 10}
+		euro    = AlertRule{NamePrefix: "Apple", Kind: AlertBelow, Threshold: MustParseAmount("900"), Currency: "EUR"}
+		samsung = AlertRule{NamePrefix: "Samsung", Kind: AlertBelow, Threshold: MustParseAmount("900"), Currency: "USD"}
+	)
+
+	testCases := []struct {
+		Name    string
+		Rule    AlertRule
+		Product *Product
+		Fired   bool
+		Seq     int64
+	}{
+		{Name: "BelowCrossed", Rule: below, Product: product("899", "999"), Fired: true, Seq: 1},
+		{Name: "BelowStays", Rule: below, Product: product("850", "999", "899"), Fired: false},
+		{Name: "BelowCrossedAgain", Rule: below, Product: product("850", "999", "899", "950"), Fired: true, Seq: 3},
+		{Name: "BelowEqual", Rule: below, Product: product("900", "999")},
+		{Name: "BelowNew", Rule: below, Product: product("899"), Fired: true},
+		{Name: "AboveCrossed", Rule: above, Product: product("1001", "1000"), Fired: true, Seq: 1},
+		{Name: "AboveDropped", Rule: above, Product: product("999", "1001")},
+		{Name: "Drop", Rule: drop, Product: product("899", "999"), Fired: true, Seq: 1},
+		{Name: "SmallDrop", Rule: drop, Product: product("950", "999")},
+		{Name: "DropNew", Rule: drop, Product: product("899")},
+		{Name: "RiseOnDrop", Rule: rise, Product: product("899", "999")},
+		{Name: "Rise", Rule: rise, Product: product("1100", "999"), Fired: true, Seq: 1},
+		{Name: "OtherCurrency", Rule: euro, Product: product("899", "999")},
+		{Name: "OtherProduct", Rule: samsung, Product: product("899", "999")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			alert := tc.Rule.Evaluate(tc.Product)
+			if !tc.Fired {
+				r.Nil(alert)
+				return
+			}
+
+			r.NotNil(alert)
+			r.Equal(tc.Seq, alert.Seq)
+			r.Equal(tc.Product.Price, alert.Price)
+
+			if tc.Seq > 0 {
+				r.Equal(tc.Product.Changes[tc.Seq-1].Price, *alert.OldPrice)
+			} else {
+				r.Nil(alert.OldPrice)
+			}
+		})
+	}
+}
+
+func TestTriggerAlert(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	alerts := repo.(Alerts)
+
+	rule := &AlertRule{Owner: "alice", Name: "Apple iPhone 12", Kind: AlertBelow, Threshold: MustParseAmount("900"), Currency: "USD"}
+	r.NoError(alerts.SaveAlertRule(ctx, rule))
+	r.NoError(alerts.SaveAlertRule(ctx, &AlertRule{Owner: "bob", NamePrefix: "Apple", Kind: AlertChangePercent, Percent: -5}))
+	r.Equal(errInvalidData, alerts.SaveAlertRule(ctx, &AlertRule{}))
+
+	rules, err := alerts.ListAlertRules(ctx, "alice")
+	r.NoError(err)
+	r.Len(rules, 1)
+	r.Equal("900", rules[0].Threshold.String())
+
+	p := &Product{ID: primitive.NewObjectID(), Name: "Apple iPhone 12", Price: MustParseAmount("899"), Currency: "USD"}
+	p.Changes = []Change{{Price: MustParseAmount("999"), Currency: "USD"}}
+
+	// the same crossing fires once
+	for i, expected := range []bool{true, false} {
+		ok, err := alerts.TriggerAlert(ctx, rules[0].Evaluate(p))
+		r.NoError(err)
+		r.Equal(expected, ok, i)
+	}
+
+	p.Changes = append(p.Changes, Change{Price: MustParseAmount("950"), Currency: "USD"})
+
+	ok, err := alerts.TriggerAlert(ctx, rules[0].Evaluate(p))
+	r.NoError(err)
+	r.True(ok)
+
+	triggered, err := alerts.ListTriggeredAlerts(ctx, &AlertFilter{Owner: "alice"}, nil)
+	r.NoError(err)
+	r.Len(triggered, 2)
+	r.Equal(rule.ID, triggered[0].RuleID)
+	r.Equal(int64(1), triggered[0].Seq)
+	r.Equal(int64(2), triggered[1].Seq)
+	r.Equal("950", triggered[1].OldPrice.String())
+
+	triggered, err = alerts.ListTriggeredAlerts(ctx, &AlertFilter{Owner: "bob"}, nil)
+	r.NoError(err)
+	r.Empty(triggered)
+
+	r.NoError(alerts.DeleteAlertRule(ctx, rule.ID))
+	r.Equal(ErrNotFound, alerts.DeleteAlertRule(ctx, rule.ID))
+}
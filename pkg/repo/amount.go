@@ -0,0 +1,356 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+const nanosPerUnit = 1000000000
+
+var errInvalidAmount = errors.New("repository: invalid amount")
+
+// Amount is an exact decimal value with nano precision. Units and nanos
+// always have the same sign, the same way as google.type.Money does.
+// Amounts are stored in Mongo as Decimal128.
+type Amount struct {
+	units int64
+	nanos int32
+}
+
+// NewAmount returns amount from whole units and nano units.
+func NewAmount(units int64, nanos int32) (Amount, error) {
+	if nanos <= -nanosPerUnit || nanos >= nanosPerUnit {
+		return Amount{}, errInvalidAmount
+	}
+	if (units > 0 && nanos < 0) || (units < 0 && nanos > 0) {
+		return Amount{}, errInvalidAmount
+	}
+
+	return Amount{units: units, nanos: nanos}, nil
+}
+
+// ParseAmount parses decimal string like "1099.99" without rounding.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	// integer part may be omitted like in ".5", as float parsing allowed it
+	if intPart+fracPart == "" || len(fracPart) > 9 || !isDigits(intPart) || !isDigits(fracPart) {
+		return Amount{}, fmt.Errorf("%w: %q", errInvalidAmount, s)
+	}
+
+	var units int64
+	if intPart != "" {
+		var err error
+		if units, err = strconv.ParseInt(intPart, 10, 64); err != nil {
+			return Amount{}, fmt.Errorf("%w: %q", errInvalidAmount, s)
+		}
+	}
+
+	var nanos int64
+	if fracPart != "" {
+		nanos, _ = strconv.ParseInt(fracPart+strings.Repeat("0", 9-len(fracPart)), 10, 32)
+	}
+
+	if neg {
+		units, nanos = -units, -nanos
+	}
+
+	return Amount{units: units, nanos: int32(nanos)}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on invalid input.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// AmountFromFloat converts binary floating point value using its shortest
+// decimal representation, so 1099.99 becomes exactly 1099.99.
+func AmountFromFloat(f float64) (Amount, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %v", errInvalidAmount, f)
+	}
+	return AmountFromRat(r)
+}
+
+// AmountFromRat converts rational value rounding half away from zero to nanos.
+// It fails if whole units do not fit into int64.
+func AmountFromRat(r *big.Rat) (Amount, error) {
+	var (
+		n            = roundRat(new(big.Rat).Mul(r, new(big.Rat).SetInt64(nanosPerUnit)))
+		units, nanos = new(big.Int).QuoRem(n, big.NewInt(nanosPerUnit), new(big.Int))
+	)
+
+	if !units.IsInt64() {
+		return Amount{}, fmt.Errorf("%w: %s is out of range", errInvalidAmount, r.FloatString(9))
+	}
+
+	return Amount{units: units.Int64(), nanos: int32(nanos.Int64())}, nil
+}
+
+// roundRat rounds rational value half away from zero to integer.
+func roundRat(r *big.Rat) *big.Int {
+	var (
+		num  = new(big.Int).Abs(r.Num())
+		q, m = new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	)
+
+	if m.Lsh(m, 1).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	return q
+}
+
+func pow10(exp int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Units returns whole units of the amount.
+func (a Amount) Units() int64 { return a.units }
+
+// Nanos returns nano units of the amount.
+func (a Amount) Nanos() int32 { return a.nanos }
+
+// IsZero reports whether amount equals to zero.
+func (a Amount) IsZero() bool { return a.units == 0 && a.nanos == 0 }
+
+// Sign returns -1, 0 or +1 depending on amount sign.
+func (a Amount) Sign() int {
+	switch {
+	case a.units > 0 || a.nanos > 0:
+		return 1
+	case a.units < 0 || a.nanos < 0:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Cmp compares amounts and returns -1, 0 or +1.
+func (a Amount) Cmp(b Amount) int {
+	switch {
+	case a.units < b.units:
+		return -1
+	case a.units > b.units:
+		return 1
+	case a.nanos < b.nanos:
+		return -1
+	case a.nanos > b.nanos:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Rat returns amount as rational number.
+func (a Amount) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(a.nanoInt(), big.NewInt(nanosPerUnit))
+}
+
+// Float64 returns the nearest floating point value, it should be used for
+// approximate calculations only.
+func (a Amount) Float64() float64 {
+	f, _ := a.Rat().Float64()
+	return f
+}
+
+// Round rounds amount half away from zero to given decimal places.
+func (a Amount) Round(places int) Amount {
+	if places >= 9 {
+		return a
+	}
+
+	var (
+		scale   = pow10(places)
+		rounded = roundRat(new(big.Rat).Mul(a.Rat(), new(big.Rat).SetInt(scale)))
+	)
+
+	// only rounding the largest amount up overflows, it is kept as is
+	b, err := AmountFromRat(new(big.Rat).SetFrac(rounded, scale))
+	if err != nil {
+		return a
+	}
+
+	return b
+}
+
+// String returns decimal representation without trailing zeros.
+func (a Amount) String() string {
+	var (
+		sign  = ""
+		units = a.units
+		nanos = a.nanos
+	)
+
+	if a.Sign() < 0 {
+		sign, units, nanos = "-", -units, -nanos
+	}
+
+	s := sign + strconv.FormatInt(units, 10)
+	if nanos != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+	}
+
+	return s
+}
+
+// ChangePercent returns relative change between amounts in percents, it is
+// zero if the original amount is zero.
+func ChangePercent(from, to Amount) float64 {
+	if from.IsZero() {
+		return 0
+	}
+
+	delta := new(big.Rat).Sub(to.Rat(), from.Rat())
+	percent, _ := delta.Mul(delta, big.NewRat(100, 1)).Quo(delta, from.Rat()).Float64()
+
+	return percent
+}
+
+func (a Amount) nanoInt() *big.Int {
+	n := new(big.Int).Mul(big.NewInt(a.units), big.NewInt(nanosPerUnit))
+	return n.Add(n, big.NewInt(int64(a.nanos)))
+}
+
+// MarshalBSONValue encodes amount as Decimal128.
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	var (
+		n   = a.nanoInt()
+		exp = -9
+		ten = big.NewInt(10)
+		m   = new(big.Int)
+	)
+
+	for exp < 0 && n.Sign() != 0 {
+		q, r := new(big.Int).QuoRem(n, ten, m)
+		if r.Sign() != 0 {
+			break
+		}
+		n, exp = q, exp+1
+	}
+	if n.Sign() == 0 {
+		exp = 0
+	}
+
+	d, ok := primitive.ParseDecimal128FromBigInt(n, exp)
+	if !ok {
+		return 0, nil, errInvalidAmount
+	}
+
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d), nil
+}
+
+// UnmarshalBSONValue decodes amount from Decimal128. Numeric values stored
+// before decimal support are accepted as well.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.Decimal128:
+		d, ok := v.Decimal128OK()
+		if !ok {
+			return errInvalidAmount
+		}
+
+		bi, exp, err := d.BigInt()
+		if err != nil {
+			return err
+		}
+
+		r := new(big.Rat).SetInt(bi)
+		if exp < 0 {
+			r.Quo(r, new(big.Rat).SetInt(pow10(-exp)))
+		} else {
+			r.Mul(r, new(big.Rat).SetInt(pow10(exp)))
+		}
+
+		if *a, err = AmountFromRat(r); err != nil {
+			return err
+		}
+	case bsontype.Double:
+		f, ok := v.DoubleOK()
+		if !ok {
+			return errInvalidAmount
+		}
+
+		var err error
+		if *a, err = AmountFromFloat(f); err != nil {
+			return err
+		}
+	case bsontype.Int32:
+		i, ok := v.Int32OK()
+		if !ok {
+			return errInvalidAmount
+		}
+
+		*a = Amount{units: int64(i)}
+	case bsontype.Int64:
+		i, ok := v.Int64OK()
+		if !ok {
+			return errInvalidAmount
+		}
+
+		*a = Amount{units: i}
+	case bsontype.Null:
+		*a = Amount{}
+	default:
+		return fmt.Errorf("%w: unexpected bson type %s", errInvalidAmount, t)
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes amount as decimal string to keep precision.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON decodes amount from decimal string or number.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
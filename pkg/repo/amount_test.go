@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseAmount(t *testing.T) {
+	testCases := []struct {
+		Input    string
+		Units    int64
+		Nanos    int32
+		Expected string
+		Invalid  bool
+	}{
+		{Input: "1099.99", Units: 1099, Nanos: 990000000, Expected: "1099.99"},
+		{Input: "99", Units: 99, Expected: "99"},
+		{Input: "0.000000001", Nanos: 1, Expected: "0.000000001"},
+		{Input: "-0.5", Nanos: -500000000, Expected: "-0.5"},
+		{Input: "+12.50", Units: 12, Nanos: 500000000, Expected: "12.5"},
+		{Input: " 7.1 ", Units: 7, Nanos: 100000000, Expected: "7.1"},
+		{Input: "", Invalid: true},
+		{Input: ".5", Nanos: 500000000, Expected: "0.5"},
+		{Input: "-.25", Nanos: -250000000, Expected: "-0.25"},
+		{Input: "5.", Units: 5, Expected: "5"},
+		{Input: ".", Invalid: true},
+		{Input: "-", Invalid: true},
+		{Input: "1.0000000001", Invalid: true},
+		{Input: "1,5", Invalid: true},
+		{Input: "1e3", Invalid: true},
+		{Input: "99999999999999999999", Invalid: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Input, func(t *testing.T) {
+			r := require.New(t)
+
+			a, err := ParseAmount(tc.Input)
+			if tc.Invalid {
+				r.Error(err)
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Units, a.Units())
+			r.Equal(tc.Nanos, a.Nanos())
+			r.Equal(tc.Expected, a.String())
+		})
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	r := require.New(t)
+
+	a, err := AmountFromFloat(1099.99)
+	r.NoError(err)
+	r.Equal(MustParseAmount("1099.99"), a)
+
+	a, err = AmountFromFloat(0.1 + 0.2)
+	r.NoError(err)
+	r.Equal(MustParseAmount("0.3"), a.Round(2))
+
+	r.Equal(MustParseAmount("2.35"), MustParseAmount("2.345").Round(2))
+	r.Equal(MustParseAmount("-2.35"), MustParseAmount("-2.345").Round(2))
+
+	a, err = AmountFromRat(big.NewRat(1, 3))
+	r.NoError(err)
+	r.Equal(MustParseAmount("0.33"), a.Round(2))
+
+	// whole units must fit into int64
+	_, err = AmountFromRat(new(big.Rat).SetFrac(new(big.Int).Lsh(big.NewInt(1), 64), big.NewInt(1)))
+	r.True(errors.Is(err, errInvalidAmount))
+
+	_, err = AmountFromFloat(1e300)
+	r.True(errors.Is(err, errInvalidAmount))
+
+	r.Equal(-1, MustParseAmount("-1.5").Cmp(MustParseAmount("-0.5")))
+	r.Equal(1, MustParseAmount("10.01").Cmp(MustParseAmount("10")))
+	r.Equal(0, MustParseAmount("10.10").Cmp(MustParseAmount("10.1")))
+	r.Equal(-1, MustParseAmount("-0.1").Sign())
+	r.True(Amount{}.IsZero())
+}
+
+func TestChangePercent(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(-99.0, ChangePercent(MustParseAmount("999"), MustParseAmount("9.99")))
+	r.Equal(10.0, ChangePercent(MustParseAmount("100"), MustParseAmount("110")))
+	r.Equal(0.0, ChangePercent(Amount{}, MustParseAmount("110")))
+}
+
+func TestAmountBSON(t *testing.T) {
+	r := require.New(t)
+
+	type doc struct {
+		Price Amount `bson:"price"`
+	}
+
+	for _, s := range []string{"1099.99", "0", "-3.000000001", "120000"} {
+		data, err := bson.Marshal(doc{Price: MustParseAmount(s)})
+		r.NoError(err)
+
+		var raw bson.Raw = data
+		r.Equal(bson.TypeDecimal128, raw.Lookup("price").Type)
+
+		var decoded doc
+		r.NoError(bson.Unmarshal(data, &decoded))
+		r.Equal(s, decoded.Price.String())
+	}
+
+	// legacy records hold doubles and bare numbers in changes
+	legacy, err := bson.Marshal(bson.M{"price": 1099.99, "changes": bson.A{999.99, 1049}})
+	r.NoError(err)
+
+	var p Product
+	r.NoError(bson.Unmarshal(legacy, &p))
+	r.Equal("1099.99", p.Price.String())
+	r.Len(p.Changes, 2)
+	r.Equal("999.99", p.Changes[0].Price.String())
+	r.Equal("", p.Changes[0].Currency)
+}
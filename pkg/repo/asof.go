@@ -0,0 +1,239 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrHistoryIncomplete is returned when product at the given time can not be
+// told because history entries or creation time recorded before auditing
+// have no time.
+var ErrHistoryIncomplete = errors.New("repository: price history is incomplete")
+
+// AsOf returns the product as it was at the given time reconstructed from
+// its history. It returns ErrNotFound if product did not exist yet and
+// ErrHistoryIncomplete for legacy records without creation time, as it is
+// not known since when they exist. Pinning state is not recorded in history
+// and is kept as is.
+func (p *Product) AsOf(t time.Time) (*Product, error) {
+	if p.CreatedAt.IsZero() {
+		return nil, ErrHistoryIncomplete
+	}
+	if p.CreatedAt.After(t) {
+		return nil, ErrNotFound
+	}
+
+	past := *p
+	if p.DeletedAt != nil && p.DeletedAt.After(t) {
+		past.DeletedAt, past.DeletedBy = nil, ""
+	}
+
+	// changes are appended in order, so the first one made after the time
+	// holds the price in effect
+	next := len(p.Changes)
+	for i, c := range p.Changes {
+		if c.ChangedAt.After(t) {
+			next = i
+			break
+		}
+	}
+
+	if next == len(p.Changes) {
+		// price was changed after the time, but the change has no time
+		if p.UpdatedAt.After(t) {
+			return nil, ErrHistoryIncomplete
+		}
+		return &past, nil
+	}
+
+	if next > 0 && p.Changes[next-1].ChangedAt.IsZero() {
+		return nil, ErrHistoryIncomplete
+	}
+
+	past.Price = p.Changes[next].Price
+	past.Currency = p.Changes[next].PriceCurrency()
+	past.Changes = append([]Change{}, p.Changes[:next]...)
+	past.NumOfChanges = int64(next)
+	past.LastChangePercent = lastChangePercent(past.Changes, past.Price, past.Currency)
+	past.UpdatedAt = p.CreatedAt
+	if next > 0 {
+		past.UpdatedAt = p.Changes[next-1].ChangedAt
+	}
+
+	return &past, nil
+}
+
+// listProductsAsOf lists products reconstructed at the time of the filter.
+func (m *mongoRepo) listProductsAsOf(ctx context.Context, opts *ListOptions) ([]Product, error) {
+	pipeline := buildAsOfPipeline(opts.Filter)
+
+	if !opts.Paging.LastID.IsZero() {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"_id": bson.M{"$gt": opts.Paging.LastID}}}})
+	}
+	if opts.Paging.Cursor != nil {
+		keyset, err := buildKeysetFilter(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: keyset}})
+	}
+
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: buildSort(opts)}},
+		bson.D{{Key: "$limit", Value: opts.Paging.Limit}},
+	)
+
+	projection := bson.M{"_as_of": 0}
+	if len(opts.Fields) > 0 {
+		projection = bson.M{}
+		for _, f := range opts.Fields {
+			projection[f] = 1
+		}
+		for _, k := range opts.SortKeys() {
+			projection[k.Field()] = 1
+		}
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+
+	cursor, err := m.db().Collection("products").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func (m *mongoRepo) countProductsAsOf(ctx context.Context, filter *Filter) (int64, error) {
+	pipeline := append(buildAsOfPipeline(filter), bson.D{{Key: "$count", Value: "n"}})
+
+	cursor, err := m.db().Collection("products").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	var counts []struct {
+		N int64 `bson:"n"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return 0, err
+	}
+
+	// nothing is returned if no products match
+	if len(counts) == 0 {
+		return 0, nil
+	}
+
+	return counts[0].N, nil
+}
+
+// buildAsOfPipeline replaces price related fields of products with their
+// values at the time of the filter, the same way Product.AsOf does, and
+// matches the filter against them.
+func buildAsOfPipeline(f *Filter) mongo.Pipeline {
+	t := f.AsOf
+
+	// products existing at the time whose price then can be told: either
+	// it is not changed since or there is a timestamped change after it.
+	// Legacy records without creation time are skipped as incomplete, the
+	// same as ones which price at the time is unknown
+	existing := bson.A{
+		buildFilter(&Filter{
+			NamePrefix:     f.NamePrefix,
+			NameContains:   f.NameContains,
+			NameRegex:      f.NameRegex,
+			IncludeDeleted: true,
+		}),
+		// zero time or nothing is stored for legacy records without
+		// creation time
+		bson.M{"created_at": bson.M{"$gt": time.Time{}, "$lte": t}},
+		bson.M{"$or": bson.A{
+			bson.M{"updated_at": bson.M{"$lte": t}},
+			bson.M{"changes.changed_at": bson.M{"$gt": t}},
+		}},
+	}
+	if !f.IncludeDeleted {
+		existing = append(existing, bson.M{"$or": bson.A{
+			bson.M{"deleted_at": bson.M{"$exists": false}},
+			bson.M{"deleted_at": bson.M{"$gt": t}},
+		}})
+	}
+
+	var (
+		changes = bson.M{"$ifNull": bson.A{"$changes", bson.A{}}}
+		later   = bson.M{"$gt": bson.A{"$$c.changed_at", t}}
+		changed = bson.M{"$gt": bson.A{bson.M{"$size": "$_as_of.later"}, 0}}
+		price   = "$_as_of.next.price"
+		prev    = "$_as_of.prev.price"
+	)
+
+	// the same currency is checked by the condition below
+	percent := bson.M{"$abs": bson.M{"$toDouble": bson.M{"$divide": bson.A{
+		bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{price, prev}}, 100}},
+		prev,
+	}}}}
+
+	lastChangePercent := bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$_as_of.prev"}, "object"}},
+			bson.M{"$eq": bson.A{"$_as_of.prev.currency", "$_as_of.next.currency"}},
+			bson.M{"$ne": bson.A{prev, 0}},
+		}},
+		percent,
+		0.0,
+	}}
+
+	unlessDeleted := func(field string) bson.M {
+		return bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$deleted_at", t}}, "$$REMOVE", field}}
+	}
+
+	// filter matches reconstructed fields except the ones matched above
+	matched := *f
+	matched.NamePrefix, matched.NameContains, matched.NameRegex = "", "", ""
+	matched.IncludeDeleted = true
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": existing}}},
+		{{Key: "$addFields", Value: bson.M{"_as_of": bson.M{
+			"later": bson.M{"$filter": bson.M{"input": changes, "as": "c", "cond": later}},
+			"kept":  bson.M{"$filter": bson.M{"input": changes, "as": "c", "cond": bson.M{"$not": bson.A{later}}}},
+		}}}},
+		{{Key: "$addFields", Value: bson.M{
+			"_as_of.next": bson.M{"$arrayElemAt": bson.A{"$_as_of.later", 0}},
+			"_as_of.prev": bson.M{"$arrayElemAt": bson.A{"$_as_of.kept", -1}},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"price":               bson.M{"$cond": bson.A{changed, price, "$price"}},
+			"currency":            bson.M{"$cond": bson.A{changed, "$_as_of.next.currency", "$currency"}},
+			"changes":             bson.M{"$cond": bson.A{changed, "$_as_of.kept", "$changes"}},
+			"num_of_changes":      bson.M{"$cond": bson.A{changed, bson.M{"$size": "$_as_of.kept"}, "$num_of_changes"}},
+			"last_change_percent": bson.M{"$cond": bson.A{changed, lastChangePercent, "$last_change_percent"}},
+			"updated_at": bson.M{"$cond": bson.A{
+				changed,
+				bson.M{"$ifNull": bson.A{"$_as_of.prev.changed_at", "$created_at"}},
+				"$updated_at",
+			}},
+			"deleted_at": unlessDeleted("$deleted_at"),
+			"deleted_by": unlessDeleted("$deleted_by"),
+			// the change preceding the one after the time must have time
+			"_as_of.known": bson.M{"$or": bson.A{
+				bson.M{"$not": bson.A{changed}},
+				bson.M{"$eq": bson.A{bson.M{"$size": "$_as_of.kept"}, 0}},
+				bson.M{"$eq": bson.A{bson.M{"$type": "$_as_of.prev.changed_at"}, "date"}},
+			}},
+		}}},
+		{{Key: "$match", Value: bson.M{"$and": bson.A{
+			bson.M{"_as_of.known": true},
+			buildFilter(&matched),
+		}}}},
+	}
+}
@@ -0,0 +1,231 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestProductAsOf(t *testing.T) {
+	var (
+		t0 = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(24 * time.Hour)
+		t2 = t1.Add(24 * time.Hour)
+	)
+
+	product := &Product{
+		Name:      "Apple iPhone 12",
+		Price:     MustParseAmount("799"),
+		Currency:  "USD",
+		CreatedAt: t0,
+		UpdatedAt: t2,
+		Changes: []Change{
+			{Price: MustParseAmount("999"), Currency: "USD", ChangedAt: t1},
+			{Price: MustParseAmount("899"), Currency: "USD", ChangedAt: t2},
+		},
+		NumOfChanges: 2,
+	}
+	product.LastChangePercent = lastChangePercent(product.Changes, product.Price, product.Currency)
+
+	deleted := *product
+	deleted.DeletedAt, deleted.DeletedBy = &t1, "admin"
+
+	legacy := *product
+	legacy.Changes = []Change{
+		{Price: MustParseAmount("1099")},
+		{Price: MustParseAmount("999"), Currency: "USD"},
+		{Price: MustParseAmount("899"), Currency: "USD", ChangedAt: t2},
+	}
+	legacy.NumOfChanges = 3
+
+	testCases := []struct {
+		Name    string
+		Product *Product
+		At      time.Time
+		Err     error
+		Price   string
+		Changes int
+		Updated time.Time
+		Deleted bool
+		Percent float64
+	}{
+		{Name: "BeforeCreation", Product: product, At: t0.Add(-time.Second), Err: ErrNotFound},
+		{Name: "Created", Product: product, At: t0, Price: "999", Updated: t0},
+		{Name: "Changed", Product: product, At: t1, Price: "899", Changes: 1, Updated: t1, Percent: 10.01001001001001},
+		{Name: "Current", Product: product, At: t2.Add(time.Hour), Price: "799", Changes: 2, Updated: t2, Percent: product.LastChangePercent},
+		{Name: "DeletedLater", Product: &deleted, At: t0, Price: "999", Updated: t0},
+		{Name: "Deleted", Product: &deleted, At: t1, Price: "899", Changes: 1, Updated: t1, Deleted: true, Percent: 10.01001001001001},
+		{Name: "LegacyUnknown", Product: &legacy, At: t1, Err: ErrHistoryIncomplete},
+		{Name: "LegacyCurrent", Product: &legacy, At: t2, Price: "799", Changes: 3, Updated: t2, Percent: product.LastChangePercent},
+		{Name: "NoCreationTime", Product: &Product{Price: MustParseAmount("1")}, At: t2, Err: ErrHistoryIncomplete},
+		{
+			Name:    "UntimedLastChange",
+			Product: &Product{Price: MustParseAmount("1"), CreatedAt: t0, UpdatedAt: t2, Changes: []Change{{Price: MustParseAmount("2")}}},
+			At:      t1,
+			Err:     ErrHistoryIncomplete,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			p, err := tc.Product.AsOf(tc.At)
+			if tc.Err != nil {
+				r.Equal(tc.Err, err)
+				return
+			}
+
+			r.NoError(err)
+			r.Equal(tc.Price, p.Price.String())
+			r.Equal("USD", p.PriceCurrency())
+			r.Len(p.Changes, tc.Changes)
+			r.Equal(int64(tc.Changes), p.NumOfChanges)
+			r.Equal(tc.Updated, p.UpdatedAt)
+			r.Equal(tc.Deleted, p.DeletedAt != nil)
+			r.InDelta(tc.Percent, p.LastChangePercent, 1e-9)
+		})
+	}
+
+	// original product is kept intact
+	r := require.New(t)
+	r.Equal("799", product.Price.String())
+	r.Len(product.Changes, 2)
+}
+
+func TestListProductsAsOf(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	var (
+		t0 = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(24 * time.Hour)
+		t2 = t1.Add(24 * time.Hour)
+	)
+
+	for _, save := range []struct {
+		Name  string
+		Price string
+		At    time.Time
+	}{
+		{"Apple iPhone 12", "999", t0},
+		{"Samsung Galaxy S21", "799", t0},
+		{"Apple iPhone 12", "899", t1},
+		{"Google Pixel 5", "699", t1},
+		{"Apple iPhone 12", "799", t2},
+		{"Samsung Galaxy S21", "849", t2},
+	} {
+		p := NewProduct(func(p *Product) {
+			p.Name = save.Name
+			p.Price = MustParseAmount(save.Price)
+			p.Currency = "USD"
+			p.UpdatedAt = save.At
+		})
+		r.NoError(repo.SaveProduct(ctx, p))
+	}
+
+	// history recorded before auditing does not tell when price was changed
+	legacy := &Product{
+		ID:        primitive.NewObjectID(),
+		Name:      "Nokia 3310",
+		Price:     MustParseAmount("49"),
+		Currency:  "USD",
+		Changes:   []Change{{Price: MustParseAmount("59"), Currency: "USD"}},
+		CreatedAt: t0,
+		UpdatedAt: t1,
+	}
+	_, err = conn.Database("productstore_test").Collection("products").InsertOne(ctx, legacy)
+	r.NoError(err)
+
+	// records saved before creation time was introduced
+	_, err = conn.Database("productstore_test").Collection("products").InsertOne(ctx, bson.M{
+		"_id":        primitive.NewObjectID(),
+		"name":       "Motorola Razr",
+		"price":      MustParseAmount("1499"),
+		"currency":   "USD",
+		"changes":    bson.A{},
+		"updated_at": t0,
+	})
+	r.NoError(err)
+
+	pixel, err := repo.FindByName(ctx, "Google Pixel 5")
+	r.NoError(err)
+	r.NoError(repo.DeleteProduct(ctx, pixel.ID, "admin", t2))
+
+	list := func(f *Filter, sorting SortingOption) []Product {
+		products, err := repo.ListProducts(ctx, &ListOptions{Sorting: sorting, Direction: Asc, Filter: f})
+		r.NoError(err)
+
+		count, err := repo.CountProducts(ctx, f)
+		r.NoError(err)
+		r.Equal(int64(len(products)), count)
+
+		return products
+	}
+
+	products := list(&Filter{AsOf: t0}, SortByPrice)
+	r.Len(products, 2)
+	r.Equal("Samsung Galaxy S21", products[0].Name)
+	r.Equal("799", products[0].Price.String())
+	r.Equal("Apple iPhone 12", products[1].Name)
+	r.Equal("999", products[1].Price.String())
+	r.Empty(products[1].Changes)
+	r.Equal(t0, products[1].UpdatedAt.UTC())
+
+	products = list(&Filter{AsOf: t1}, SortByPrice)
+	r.Len(products, 4)
+	for _, p := range products {
+		stored, err := repo.FindByID(ctx, p.ID)
+		r.NoError(err)
+
+		expected, err := stored.AsOf(t1)
+		r.NoError(err)
+		r.Equal(expected.Price.String(), p.Price.String(), p.Name)
+		r.Equal(expected.NumOfChanges, p.NumOfChanges, p.Name)
+		r.InDelta(expected.LastChangePercent, p.LastChangePercent, 1e-9, p.Name)
+		r.Equal(expected.UpdatedAt.UTC(), p.UpdatedAt.UTC(), p.Name)
+		r.Nil(p.DeletedAt, p.Name)
+	}
+
+	min := MustParseAmount("800")
+	products = list(&Filter{AsOf: t1, MinPrice: &min, MinChanges: 1}, SortByDefault)
+	r.Len(products, 1)
+	r.Equal("899", products[0].Price.String())
+
+	// legacy product is skipped before its untimed change
+	products = list(&Filter{AsOf: t0, NamePrefix: "Nokia"}, SortByDefault)
+	r.Empty(products)
+
+	// it is not known since when products without creation time exist
+	products = list(&Filter{AsOf: t2, NamePrefix: "Motorola"}, SortByDefault)
+	r.Empty(products)
+
+	products = list(&Filter{AsOf: t2, NamePrefix: "Nokia"}, SortByDefault)
+	r.Len(products, 1)
+	r.Equal("49", products[0].Price.String())
+
+	products = list(&Filter{AsOf: t2}, SortByName)
+	r.Len(products, 3)
+
+	products = list(&Filter{AsOf: t2, IncludeDeleted: true}, SortByName)
+	r.Len(products, 4)
+	r.Equal("Google Pixel 5", products[1].Name)
+	r.NotNil(products[1].DeletedAt)
+}
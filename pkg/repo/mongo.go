@@ -2,78 +2,253 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// _duplicateKey is returned by Mongo when unique index is violated.
+const _duplicateKey = 11000
+
 type mongoRepo struct {
 	name   string
 	client *mongo.Client
+	outbox bool
 }
 
-func NewMongoRepo(name string, client *mongo.Client) Repository {
-	return &mongoRepo{name: name, client: client}
+// MongoOption configures Mongo repository.
+type MongoOption func(*mongoRepo)
+
+// WithOutbox writes price change events to the outbox collection in the
+// same transaction as the product. Transactions require a replica set, and
+// Mongo prior to 4.4 needs collections to be created by EnsureIndexes.
+func WithOutbox() MongoOption {
+	return func(m *mongoRepo) {
+		m.outbox = true
+	}
+}
+
+func NewMongoRepo(name string, client *mongo.Client, opts ...MongoOption) Repository {
+	m := &mongoRepo{name: name, client: client}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
 }
 
 func (m *mongoRepo) db() *mongo.Database {
 	return m.client.Database(m.name)
 }
 
-func (m *mongoRepo) FindByName(ctx context.Context, name string) *Product {
+func isDuplicateKey(err error) bool {
+	var we mongo.WriteException
+	if !errors.As(err, &we) {
+		return false
+	}
+
+	for _, e := range we.WriteErrors {
+		if e.Code == _duplicateKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *mongoRepo) FindByName(ctx context.Context, name string) (*Product, error) {
+	return m.findProduct(ctx, bson.M{"name": name})
+}
+
+func (m *mongoRepo) FindByID(ctx context.Context, id primitive.ObjectID) (*Product, error) {
+	return m.findProduct(ctx, bson.M{"_id": id})
+}
+
+func (m *mongoRepo) FindBySKU(ctx context.Context, sku string) (*Product, error) {
+	if sku == "" {
+		return nil, ErrNotFound
+	}
+
+	return m.findProduct(ctx, bson.M{"sku": sku})
+}
+
+func (m *mongoRepo) findProduct(ctx context.Context, filter bson.M) (*Product, error) {
 	var p Product
-	if err := m.db().Collection("products").FindOne(ctx, bson.M{"name": name}).Decode(&p); err == nil {
-		return &p
+
+	err := m.db().Collection("products").FindOne(ctx, filter).Decode(&p)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &p, nil
 }
 
-func (m *mongoRepo) SaveProduct(ctx context.Context, p *Product) error {
+func (m *mongoRepo) SaveProduct(ctx context.Context, p *Product, opts ...SaveOption) error {
 	if p == nil {
 		return errInvalidData
 	}
 
-	old := m.FindByName(ctx, p.Name)
-	if old == nil {
+	o := newSaveOptions(opts...)
+
+	if !m.outbox {
+		_, err := m.saveProduct(ctx, p, o)
+		return err
+	}
+
+	sess, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(ctx)
+
+	// product and its event are written atomically
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		e, err := m.saveProduct(sc, p, o)
+		if err != nil || e == nil {
+			return nil, err
+		}
+
+		return m.db().Collection("outbox").InsertOne(sc, e)
+	})
+
+	return err
+}
+
+// saveProduct inserts or updates product, it returns event describing the
+// new price or nil if the price is kept.
+func (m *mongoRepo) saveProduct(ctx context.Context, p *Product, o *saveOptions) (*OutboxEvent, error) {
+	if p.Currency == "" {
+		p.Currency = DefaultCurrency
+	}
+
+	old, err := m.FindByName(ctx, p.Name)
+	if errors.Is(err, ErrNotFound) {
+		if p.CreatedAt.IsZero() {
+			p.CreatedAt = p.UpdatedAt
+		}
+		if o.pin != nil {
+			p.Pinned = *o.pin
+		}
+		p.NumOfChanges = int64(len(p.Changes))
+		p.LastChangePercent = lastChangePercent(p.Changes, p.Price, p.Currency)
+
 		// insert new record
 		if _, err := m.db().Collection("products").InsertOne(ctx, p); err != nil {
-			return err
+			return nil, err
 		}
 
-		return nil
+		return newOutboxEvent(p.ID, p, nil, o), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		priceChanged = old.Price.Cmp(p.Price) != 0 || old.PriceCurrency() != p.Currency
+		skuChanged   = p.SKU != "" && p.SKU != old.SKU
+		pinChanged   = o.pin != nil && *o.pin != old.Pinned
+	)
+
+	if priceChanged && old.Pinned && !o.override {
+		return nil, ErrPinned
 	}
 
 	// return if no changes
-	if old.Price == p.Price {
-		return nil
+	if !priceChanged && !skuChanged && !pinChanged {
+		return nil, nil
 	}
 
 	var (
 		filter = bson.M{"name": p.Name}
-		update = bson.M{
-			"$set": bson.M{
-				"price":      p.Price,
-				"updated_at": p.UpdatedAt,
-				"changes":    append(old.Changes, old.Price),
-			},
-		}
+		set    = bson.M{}
+		update = bson.M{"$set": set}
+		event  *OutboxEvent
 	)
 
+	if priceChanged {
+		change := Change{
+			Price:     old.Price,
+			Currency:  old.PriceCurrency(),
+			ChangedAt: p.UpdatedAt,
+			Actor:     o.actor,
+			Reason:    o.reason,
+		}
+		changes := append(old.Changes, change)
+
+		set["price"] = p.Price
+		set["currency"] = p.Currency
+		set["updated_at"] = p.UpdatedAt
+		set["changes"] = changes
+		set["num_of_changes"] = int64(len(changes))
+		set["last_change_percent"] = lastChangePercent(changes, p.Price, p.Currency)
+		event = newOutboxEvent(old.ID, p, &change, o)
+	}
+
+	if skuChanged {
+		set["sku"] = p.SKU
+	}
+
+	if pinChanged {
+		set["pinned"] = *o.pin
+	}
+
 	if _, err := m.db().Collection("products").UpdateOne(ctx, filter, update); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return event, nil
 }
 
 func (m *mongoRepo) ListProducts(ctx context.Context, opts *ListOptions) ([]Product, error) {
-	buildListOptions(opts)
+	opts = buildListOptions(opts)
 
-	filter := bson.M{}
-	if len(opts.Paging.LastID) > 0 {
-		filter = bson.M{"_id": bson.M{"$gt": opts.Paging.LastID}}
+	var (
+		products []Product
+		err      error
+	)
+
+	if opts.Filter != nil && !opts.Filter.AsOf.IsZero() {
+		products, err = m.listProductsAsOf(ctx, opts)
+	} else {
+		products, err = m.listProducts(ctx, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// backward page is read in reverse order
+	if opts.Paging.Backward {
+		for i, j := 0, len(products)-1; i < j; i, j = i+1, j-1 {
+			products[i], products[j] = products[j], products[i]
+		}
+	}
+
+	return products, nil
+}
+
+func (m *mongoRepo) listProducts(ctx context.Context, opts *ListOptions) ([]Product, error) {
+	filter := buildFilter(opts.Filter)
+	if !opts.Paging.LastID.IsZero() {
+		filter["_id"] = bson.M{"$gt": opts.Paging.LastID}
+	}
+	if opts.Paging.Cursor != nil {
+		keyset, err := buildKeysetFilter(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		filter = bson.M{"$and": bson.A{filter, keyset}}
 	}
 
 	cursor, err := m.db().Collection("products").Find(ctx, filter, buildFindOptions(opts))
@@ -89,7 +264,74 @@ func (m *mongoRepo) ListProducts(ctx context.Context, opts *ListOptions) ([]Prod
 	return products, nil
 }
 
-func buildListOptions(opts *ListOptions) {
+func (m *mongoRepo) CountProducts(ctx context.Context, filter *Filter) (int64, error) {
+	if filter != nil && !filter.AsOf.IsZero() {
+		return m.countProductsAsOf(ctx, filter)
+	}
+
+	return m.db().Collection("products").CountDocuments(ctx, buildFilter(filter))
+}
+
+// DeleteProduct marks product as deleted, it is hidden from listings but
+// can be restored until purged.
+func (m *mongoRepo) DeleteProduct(ctx context.Context, id primitive.ObjectID, actor string, at time.Time) error {
+	var (
+		filter = bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}
+		update = bson.M{"$set": bson.M{"deleted_at": at, "deleted_by": actor}}
+	)
+
+	res, err := m.db().Collection("products").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RestoreProduct reverts soft deletion of the product.
+func (m *mongoRepo) RestoreProduct(ctx context.Context, id primitive.ObjectID) error {
+	var (
+		filter = bson.M{"_id": id, "deleted_at": bson.M{"$exists": true}}
+		update = bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	)
+
+	res, err := m.db().Collection("products").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// PurgeProduct removes product which was soft deleted before the given time.
+func (m *mongoRepo) PurgeProduct(ctx context.Context, id primitive.ObjectID, deletedBefore time.Time) error {
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$lte": deletedBefore}}
+
+	res, err := m.db().Collection("products").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount > 0 {
+		return nil
+	}
+
+	if _, err := m.FindByID(ctx, id); err != nil {
+		return err
+	}
+
+	return ErrRetained
+}
+
+func buildListOptions(opts *ListOptions) *ListOptions {
 	if opts == nil {
 		opts = &ListOptions{
 			Direction: Desc,
@@ -105,23 +347,464 @@ func buildListOptions(opts *ListOptions) {
 			opts.Paging.Limit = 10
 		}
 	}
+
+	return opts
 }
 
-func buildFindOptions(opts *ListOptions) *options.FindOptions {
-	fopts := options.Find()
+func buildFilter(f *Filter) bson.M {
+	filter := bson.M{}
+	if f == nil {
+		f = &Filter{}
+	}
+
+	if !f.IncludeDeleted {
+		filter["deleted_at"] = bson.M{"$exists": false}
+	}
+
+	var name bson.A
+	if f.NamePrefix != "" {
+		// anchored case sensitive expression is able to use the index
+		name = append(name, bson.M{"name": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.NamePrefix)}})
+	}
+	if f.NameContains != "" {
+		name = append(name, bson.M{"name": primitive.Regex{Pattern: regexp.QuoteMeta(f.NameContains), Options: "i"}})
+	}
+	if f.NameRegex != "" {
+		name = append(name, bson.M{"name": primitive.Regex{Pattern: f.NameRegex}})
+	}
+	if len(name) > 0 {
+		filter["$and"] = name
+	}
+
+	price := bson.M{}
+	if f.MinPrice != nil {
+		price["$gte"] = *f.MinPrice
+	}
+	if f.MaxPrice != nil {
+		price["$lte"] = *f.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
+
+	if f.Currency != "" {
+		filter["currency"] = f.Currency
+	}
+
+	updated := bson.M{}
+	if !f.UpdatedAfter.IsZero() {
+		updated["$gt"] = f.UpdatedAfter
+	}
+	if !f.UpdatedBefore.IsZero() {
+		updated["$lt"] = f.UpdatedBefore
+	}
+	if len(updated) > 0 {
+		filter["updated_at"] = updated
+	}
+
+	// product has at least N changes if the N-th element of history exists
+	if f.MinChanges > 0 {
+		filter["changes."+strconv.Itoa(f.MinChanges-1)] = bson.M{"$exists": true}
+	}
+
+	if f.MinChangePercent > 0 {
+		filter["last_change_percent"] = bson.M{"$gte": f.MinChangePercent}
+	}
+
+	if f.Stale {
+		filter["stale"] = true
+	}
+
+	return filter
+}
+
+func (m *mongoRepo) SearchProducts(ctx context.Context, opts *SearchOptions) ([]SearchResult, error) {
+	var (
+		score  = bson.M{"$meta": "textScore"}
+		filter = bson.M{"$text": bson.M{"$search": opts.Query}, "deleted_at": bson.M{"$exists": false}}
+		fopts  = options.Find().
+			SetProjection(bson.M{"score": score}).
+			SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}).
+			SetSkip(opts.Offset).
+			SetLimit(opts.Limit)
+	)
+
+	cursor, err := m.db().Collection("products").Find(ctx, filter, fopts)
+	if err != nil {
+		return nil, err
+	}
 
-	switch opts.Sorting {
-	case SortByName:
-		fopts.SetSort(bson.M{"name": opts.DirIndex()})
-	case SortByPrice:
-		fopts.SetSort(bson.M{"price": opts.DirIndex()})
-	case SortByUpdatedAt:
-		fopts.SetSort(bson.M{"updated_at": opts.DirIndex()})
-	default:
-		break
+	var found []struct {
+		Product `bson:",inline"`
+		Score   float64 `bson:"score"`
 	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(found))
+	for _, f := range found {
+		results = append(results, SearchResult{Product: f.Product, Score: f.Score})
+	}
+
+	return results, nil
+}
+
+func (m *mongoRepo) EnsureIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		"products": {
+			{Keys: bson.D{{Key: "name", Value: 1}}},
+			{Keys: bson.D{{Key: "sku", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "price", Value: 1}}},
+			{Keys: bson.D{{Key: "currency", Value: 1}, {Key: "price", Value: 1}}},
+			{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+			{Keys: bson.D{{Key: "created_at", Value: 1}}},
+			{Keys: bson.D{{Key: "num_of_changes", Value: 1}}},
+			{Keys: bson.D{{Key: "last_change_percent", Value: 1}}},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "changes.changed_at", Value: 1}}},
+			{Keys: bson.D{{Key: "last_seen_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "stale", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{
+				Keys:    bson.D{{Key: "name", Value: "text"}},
+				Options: options.Index().SetName("search").SetWeights(bson.M{"name": 10}),
+			},
+		},
+		"rates": {
+			{Keys: bson.D{{Key: "from", Value: 1}, {Key: "to", Value: 1}, {Key: "effective_at", Value: -1}}},
+		},
+		"outbox": {
+			{Keys: bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}},
+		},
+		"deliveries": {
+			{
+				Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "event_id", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		},
+		"alert_rules": {
+			{Keys: bson.D{{Key: "owner", Value: 1}}},
+		},
+		"alerts": {
+			{
+				Keys:    bson.D{{Key: "rule_id", Value: 1}, {Key: "product_id", Value: 1}, {Key: "seq", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+			{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "_id", Value: 1}}},
+		},
+		"quarantine": {
+			{Keys: bson.D{{Key: "name", Value: 1}, {Key: "price", Value: 1}, {Key: "currency", Value: 1}}},
+		},
+	}
+
+	for coll, models := range indexes {
+		if _, err := m.db().Collection(coll).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s indexes: %w", coll, err)
+		}
+	}
+
+	return nil
+}
+
+// buildSort returns sorting keys in read order, which is reversed when
+// paging backward. Id is the last key to make the order deterministic.
+func buildSort(opts *ListOptions) bson.D {
+	rev := 1
+	if opts.Paging.Backward {
+		rev = -1
+	}
+
+	sort := bson.D{}
+	for _, k := range opts.SortKeys() {
+		sort = append(sort, bson.E{Key: k.Field(), Value: k.DirIndex() * rev})
+	}
+
+	return append(sort, bson.E{Key: "_id", Value: rev})
+}
+
+// buildKeysetFilter matches products following the cursor in read order:
+// the ones which are equal to the cursor by first N keys and follow it by
+// the next one.
+func buildKeysetFilter(opts *ListOptions) (bson.M, error) {
+	var (
+		c      = opts.Paging.Cursor
+		sort   = buildSort(opts)
+		values = append(append([]interface{}{}, c.Values...), c.ID)
+		or     = bson.A{}
+	)
+
+	if len(values) != len(sort) {
+		return nil, fmt.Errorf("%w: cursor does not match sorting", errInvalidData)
+	}
+
+	for i, key := range sort {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sort[j].Key] = values[j]
+		}
+
+		op := "$gt"
+		if key.Value.(int) < 0 {
+			op = "$lt"
+		}
+		cond[key.Key] = bson.M{op: values[i]}
+
+		or = append(or, cond)
+	}
+
+	return bson.M{"$or": or}, nil
+}
 
+func buildFindOptions(opts *ListOptions) *options.FindOptions {
+	fopts := options.Find()
+
+	fopts.SetSort(buildSort(opts))
 	fopts.SetLimit(opts.Paging.Limit)
 
+	if len(opts.Fields) > 0 {
+		projection := bson.M{}
+		for _, f := range opts.Fields {
+			projection[f] = 1
+		}
+		for _, k := range opts.SortKeys() {
+			projection[k.Field()] = 1
+		}
+
+		fopts.SetProjection(projection)
+	}
+
 	return fopts
 }
+
+// MigrateDecimalPrices rewrites prices stored as doubles, including the ones
+// in the history of changes, into Decimal128 values.
+func (m *mongoRepo) MigrateDecimalPrices(ctx context.Context) (int64, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"price": bson.M{"$type": "double"}},
+		bson.M{"changes": bson.M{"$type": "double"}},
+		bson.M{"changes.price": bson.M{"$type": "double"}},
+	}}
+
+	cursor, err := m.db().Collection("products").Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var p Product
+		if err := cursor.Decode(&p); err != nil {
+			return migrated, err
+		}
+
+		for i := range p.Changes {
+			if p.Changes[i].Currency == "" {
+				p.Changes[i].Currency = DefaultCurrency
+			}
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"price":    p.Price,
+				"currency": p.PriceCurrency(),
+				"changes":  p.Changes,
+			},
+		}
+
+		if _, err := m.db().Collection("products").UpdateOne(ctx, bson.M{"_id": p.ID}, update); err != nil {
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+// MigrateChangeStats fills denormalised change fields and creation time of
+// products saved before they were introduced, so that sorting and filtering
+// by them does not skip such products. Creation time is taken from the id.
+func (m *mongoRepo) MigrateChangeStats(ctx context.Context) (int64, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"num_of_changes": bson.M{"$exists": false}},
+		bson.M{"last_change_percent": bson.M{"$exists": false}},
+		bson.M{"created_at": bson.M{"$exists": false}},
+		bson.M{"created_at": time.Time{}},
+	}}
+
+	cursor, err := m.db().Collection("products").Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var p Product
+		if err := cursor.Decode(&p); err != nil {
+			return migrated, err
+		}
+
+		set := bson.M{
+			"num_of_changes":      int64(len(p.Changes)),
+			"last_change_percent": lastChangePercent(p.Changes, p.Price, p.PriceCurrency()),
+		}
+		if p.CreatedAt.IsZero() {
+			set["created_at"] = p.ID.Timestamp().UTC()
+		}
+
+		update := bson.M{"$set": set}
+
+		if _, err := m.db().Collection("products").UpdateOne(ctx, bson.M{"_id": p.ID}, update); err != nil {
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	return migrated, cursor.Err()
+}
+
+func (m *mongoRepo) SaveRate(ctx context.Context, r *Rate) error {
+	if r == nil || r.From == "" || r.To == "" || r.Rate <= 0 {
+		return errInvalidData
+	}
+
+	if r.ID.IsZero() {
+		r.ID = primitive.NewObjectID()
+	}
+
+	var (
+		filter = bson.M{"from": r.From, "to": r.To, "effective_at": r.EffectiveAt}
+		update = bson.M{
+			"$set":         bson.M{"rate": r.Rate},
+			"$setOnInsert": bson.M{"_id": r.ID},
+		}
+	)
+
+	_, err := m.db().Collection("rates").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (m *mongoRepo) FindRate(ctx context.Context, from, to string, at time.Time) (*Rate, error) {
+	var (
+		r      Rate
+		filter = bson.M{"from": from, "to": to, "effective_at": bson.M{"$lte": at}}
+		fopts  = options.FindOne().SetSort(bson.M{"effective_at": -1})
+	)
+
+	err := m.db().Collection("rates").FindOne(ctx, filter, fopts).Decode(&r)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (m *mongoRepo) ListRates(ctx context.Context) ([]Rate, error) {
+	fopts := options.Find().SetSort(bson.D{
+		{Key: "from", Value: 1},
+		{Key: "to", Value: 1},
+		{Key: "effective_at", Value: -1},
+	})
+
+	cursor, err := m.db().Collection("rates").Find(ctx, bson.M{}, fopts)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []Rate
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
+
+func (m *mongoRepo) QuarantineProduct(ctx context.Context, q *Quarantined) error {
+	if q == nil || q.Name == "" {
+		return errInvalidData
+	}
+
+	if q.ID.IsZero() {
+		q.ID = primitive.NewObjectID()
+	}
+
+	// the same rejected price is kept once no matter how many times it was imported
+	var (
+		filter = bson.M{"name": q.Name, "price": q.Price, "currency": q.Currency}
+		update = bson.M{
+			"$set": bson.M{
+				"reason": q.Reason,
+				"source": q.Source,
+			},
+			"$setOnInsert": bson.M{
+				"_id":        q.ID,
+				"created_at": q.CreatedAt,
+			},
+		}
+	)
+
+	_, err := m.db().Collection("quarantine").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (m *mongoRepo) FindQuarantined(ctx context.Context, id primitive.ObjectID) (*Quarantined, error) {
+	var q Quarantined
+
+	err := m.db().Collection("quarantine").FindOne(ctx, bson.M{"_id": id}).Decode(&q)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+func (m *mongoRepo) ListQuarantined(ctx context.Context, paging *Pager) ([]Quarantined, error) {
+	if paging == nil {
+		paging = &Pager{}
+	}
+	if paging.Limit == 0 {
+		paging.Limit = 10
+	}
+
+	filter := bson.M{}
+	if !paging.LastID.IsZero() {
+		filter = bson.M{"_id": bson.M{"$gt": paging.LastID}}
+	}
+
+	fopts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(paging.Limit)
+
+	cursor, err := m.db().Collection("quarantine").Find(ctx, filter, fopts)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Quarantined
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (m *mongoRepo) DeleteQuarantined(ctx context.Context, id primitive.ObjectID) error {
+	res, err := m.db().Collection("quarantine").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -18,22 +19,22 @@ func TestSaveProduct(t *testing.T) {
 
 	testCases := []struct {
 		Prod     *Product
-		NewPrice float64
+		NewPrice Amount
 	}{
 		{
 			Prod: NewProduct(func(p *Product) {
 				p.Name = "Apple MacBook Pro"
-				p.Price = 1299
+				p.Price = MustParseAmount("1299")
 				p.UpdatedAt = now
 			}),
 		},
 		{
 			Prod: NewProduct(func(p *Product) {
 				p.Name = "Apple iPhone 12 PRO"
-				p.Price = 1099
+				p.Price = MustParseAmount("1099")
 				p.UpdatedAt = now
 			}),
-			NewPrice: 999,
+			NewPrice: MustParseAmount("999"),
 		},
 	}
 
@@ -53,9 +54,9 @@ func TestSaveProduct(t *testing.T) {
 			repo := NewMongoRepo("productstore_test", conn)
 			r.NoError(repo.SaveProduct(ctx, tc.Prod))
 
-			if tc.NewPrice > 0 {
+			if !tc.NewPrice.IsZero() {
 				old := struct {
-					price     float64
+					price     Amount
 					updatedAt time.Time
 				}{
 					price:     tc.Prod.Price,
@@ -66,10 +67,11 @@ func TestSaveProduct(t *testing.T) {
 				tc.Prod.UpdatedAt = tc.Prod.UpdatedAt.Add(1 * time.Hour)
 				r.NoError(repo.SaveProduct(ctx, tc.Prod))
 
-				new := repo.FindByName(ctx, tc.Prod.Name)
-				r.NotNil(new)
+				new, err := repo.FindByName(ctx, tc.Prod.Name)
+				r.NoError(err)
 				r.Len(new.Changes, 1)
-				r.Equal(old.price, new.Changes[0])
+				r.Equal(old.price, new.Changes[0].Price)
+				r.Equal(DefaultCurrency, new.Changes[0].Currency)
 
 				r.True(new.UpdatedAt.After(old.updatedAt))
 			}
@@ -77,6 +79,413 @@ func TestSaveProduct(t *testing.T) {
 	}
 }
 
+func TestSaveProductCurrency(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	prod := NewProduct(func(p *Product) {
+		p.Name = "Apple iPhone 12"
+		p.Price = MustParseAmount("899")
+		p.Currency = "USD"
+		p.UpdatedAt = time.Now().UTC()
+	})
+	r.NoError(repo.SaveProduct(ctx, prod))
+
+	// same amount in another currency is a change
+	prod.Currency = "EUR"
+	r.NoError(repo.SaveProduct(ctx, prod))
+
+	loaded, err := repo.FindByName(ctx, prod.Name)
+	r.NoError(err)
+	r.Equal("EUR", loaded.Currency)
+	r.Len(loaded.Changes, 1)
+	r.Equal(Change{Price: MustParseAmount("899"), Currency: "USD"}, loaded.Changes[0])
+}
+
+func TestSaveProductPinned(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	product := func(price string) *Product {
+		return NewProduct(func(p *Product) {
+			p.Name = "Apple iPhone 12"
+			p.Price = MustParseAmount(price)
+			p.UpdatedAt = now
+		})
+	}
+
+	r.NoError(repo.SaveProduct(ctx, product("999"), Pin(true)))
+	r.Equal(ErrPinned, repo.SaveProduct(ctx, product("899")))
+	r.NoError(repo.SaveProduct(ctx, product("849"), WithAudit("admin", "typo"), Override()))
+
+	loaded, err := repo.FindByName(ctx, "Apple iPhone 12")
+	r.NoError(err)
+	r.True(loaded.Pinned)
+	r.Equal("849", loaded.Price.String())
+	r.Len(loaded.Changes, 1)
+	r.Equal("admin", loaded.Changes[0].Actor)
+	r.Equal("typo", loaded.Changes[0].Reason)
+	r.True(now.Equal(loaded.Changes[0].ChangedAt))
+
+	// unpinning alone is saved
+	r.NoError(repo.SaveProduct(ctx, product("849"), Pin(false)))
+	r.NoError(repo.SaveProduct(ctx, product("899")))
+
+	loaded, err = repo.FindByName(ctx, "Apple iPhone 12")
+	r.NoError(err)
+	r.False(loaded.Pinned)
+	r.Equal("899", loaded.Price.String())
+	r.Empty(loaded.Changes[1].Actor)
+}
+
+func TestFindProduct(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	prod := NewProduct(func(p *Product) {
+		p.Name = "Apple iPhone 12"
+		p.Price = MustParseAmount("899")
+		p.UpdatedAt = now
+	})
+	r.NoError(repo.SaveProduct(ctx, prod))
+
+	// sku is attached later without recording a price change
+	prod.SKU = "APL-IP12"
+	prod.UpdatedAt = now.Add(time.Hour)
+	r.NoError(repo.SaveProduct(ctx, prod))
+
+	byName, err := repo.FindByName(ctx, prod.Name)
+	r.NoError(err)
+	r.Equal("APL-IP12", byName.SKU)
+	r.Empty(byName.Changes)
+	r.Equal(now, byName.CreatedAt)
+	r.Equal(now, byName.UpdatedAt)
+
+	byID, err := repo.FindByID(ctx, byName.ID)
+	r.NoError(err)
+	r.Equal(prod.Name, byID.Name)
+
+	bySKU, err := repo.FindBySKU(ctx, "APL-IP12")
+	r.NoError(err)
+	r.Equal(prod.Name, bySKU.Name)
+
+	_, err = repo.FindByName(ctx, "Apple iPhone 13")
+	r.Equal(ErrNotFound, err)
+
+	_, err = repo.FindByID(ctx, primitive.NewObjectID())
+	r.Equal(ErrNotFound, err)
+
+	_, err = repo.FindBySKU(ctx, "")
+	r.Equal(ErrNotFound, err)
+}
+
+func TestMigrateDecimalPrices(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	legacy := bson.M{
+		"_id":        primitive.NewObjectID(),
+		"name":       "Apple iPhone 12",
+		"price":      1099.99,
+		"changes":    bson.A{999.99, 1049.5},
+		"updated_at": time.Now().UTC(),
+	}
+
+	_, err = conn.Database("productstore_test").Collection("products").InsertOne(ctx, legacy)
+	r.NoError(err)
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	n, err := repo.(Migrator).MigrateDecimalPrices(ctx)
+	r.NoError(err)
+	r.Equal(int64(1), n)
+
+	var raw bson.Raw
+	r.NoError(conn.Database("productstore_test").Collection("products").FindOne(ctx, bson.M{}).Decode(&raw))
+	r.Equal(bson.TypeDecimal128, raw.Lookup("price").Type)
+	r.Equal(bson.TypeDecimal128, raw.Lookup("changes", "0", "price").Type)
+
+	loaded, err := repo.FindByName(ctx, "Apple iPhone 12")
+	r.NoError(err)
+	r.Equal(MustParseAmount("1099.99"), loaded.Price)
+	r.Equal(Change{Price: MustParseAmount("999.99"), Currency: DefaultCurrency}, loaded.Changes[0])
+
+	// nothing left to migrate
+	n, err = repo.(Migrator).MigrateDecimalPrices(ctx)
+	r.NoError(err)
+	r.Equal(int64(0), n)
+}
+
+func TestMigrateChangeStats(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	id := primitive.NewObjectID()
+
+	legacy := bson.M{
+		"_id":        id,
+		"name":       "Apple iPhone 12",
+		"price":      MustParseAmount("1100"),
+		"currency":   "USD",
+		"changes":    bson.A{Change{Price: MustParseAmount("999"), Currency: "USD"}, Change{Price: MustParseAmount("1000"), Currency: "USD"}},
+		"updated_at": time.Now().UTC(),
+	}
+
+	_, err = conn.Database("productstore_test").Collection("products").InsertOne(ctx, legacy)
+	r.NoError(err)
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	n, err := repo.(Migrator).MigrateChangeStats(ctx)
+	r.NoError(err)
+	r.Equal(int64(1), n)
+
+	loaded, err := repo.FindByName(ctx, "Apple iPhone 12")
+	r.NoError(err)
+	r.Equal(int64(2), loaded.NumOfChanges)
+	r.Equal(10.0, loaded.LastChangePercent)
+	r.Equal(id.Timestamp().UTC(), loaded.CreatedAt.UTC())
+
+	// nothing left to migrate
+	n, err = repo.(Migrator).MigrateChangeStats(ctx)
+	r.NoError(err)
+	r.Equal(int64(0), n)
+}
+
+func TestListProductsByChanges(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i, p := range []struct {
+		name     string
+		prices   []string
+		currency []string
+	}{
+		{name: "Stable", prices: []string{"100"}},
+		{name: "Rising", prices: []string{"100", "110", "150"}},
+		{name: "Falling", prices: []string{"100", "80"}},
+		{name: "Relisted", prices: []string{"100", "10"}, currency: []string{"USD", "EUR"}},
+	} {
+		for j, price := range p.prices {
+			r.NoError(repo.SaveProduct(ctx, NewProduct(func(prod *Product) {
+				prod.Name = p.name
+				prod.Price = MustParseAmount(price)
+				if p.currency != nil {
+					prod.Currency = p.currency[j]
+				}
+				prod.UpdatedAt = now.Add(time.Duration(i*10+j) * time.Hour)
+			})))
+		}
+	}
+
+	stable, err := repo.FindByName(ctx, "Stable")
+	r.NoError(err)
+	r.Equal(int64(0), stable.NumOfChanges)
+	r.True(now.Equal(stable.CreatedAt))
+
+	rising, err := repo.FindByName(ctx, "Rising")
+	r.NoError(err)
+	r.Equal(int64(2), rising.NumOfChanges)
+	r.InDelta(36.36, rising.LastChangePercent, 0.01)
+
+	testCases := []struct {
+		Name     string
+		Options  *ListOptions
+		Expected []string
+	}{
+		{
+			Name:     "NumOfChanges",
+			Options:  &ListOptions{Sorting: SortByNumOfChanges, Direction: Desc, ThenBy: []SortKey{{Sorting: SortByName, Direction: Asc}}},
+			Expected: []string{"Rising", "Falling", "Relisted", "Stable"},
+		},
+		{
+			Name:     "LastChangePercent",
+			Options:  &ListOptions{Sorting: SortByLastChangePercent, Direction: Desc, ThenBy: []SortKey{{Sorting: SortByName, Direction: Asc}}},
+			Expected: []string{"Rising", "Falling", "Relisted", "Stable"},
+		},
+		{
+			Name:     "CreatedAt",
+			Options:  &ListOptions{Sorting: SortByCreatedAt, Direction: Asc},
+			Expected: []string{"Stable", "Rising", "Falling", "Relisted"},
+		},
+		{
+			Name:     "MinChangePercent",
+			Options:  &ListOptions{Filter: &Filter{MinChangePercent: 20}},
+			Expected: []string{"Rising", "Falling"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			products, err := repo.ListProducts(ctx, tc.Options)
+			r.NoError(err)
+
+			names := make([]string, 0, len(products))
+			for _, p := range products {
+				names = append(names, p.Name)
+			}
+			r.Equal(tc.Expected, names)
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	prod := NewProduct(func(p *Product) {
+		p.Name = "Apple iPhone 12"
+		p.Price = MustParseAmount("899")
+	})
+	r.NoError(repo.SaveProduct(ctx, prod))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	r.NoError(repo.DeleteProduct(ctx, prod.ID, "admin", now))
+	r.Equal(ErrNotFound, repo.DeleteProduct(ctx, prod.ID, "admin", now))
+
+	loaded, err := repo.FindByID(ctx, prod.ID)
+	r.NoError(err)
+	r.True(now.Equal(*loaded.DeletedAt))
+	r.Equal("admin", loaded.DeletedBy)
+
+	products, err := repo.ListProducts(ctx, nil)
+	r.NoError(err)
+	r.Empty(products)
+
+	count, err := repo.CountProducts(ctx, &Filter{IncludeDeleted: true})
+	r.NoError(err)
+	r.Equal(int64(1), count)
+
+	found, err := repo.(Searcher).SearchProducts(ctx, &SearchOptions{Query: "iphone", Limit: 10})
+	r.NoError(err)
+	r.Empty(found)
+
+	r.Equal(ErrRetained, repo.PurgeProduct(ctx, prod.ID, now.Add(-time.Minute)))
+
+	r.NoError(repo.RestoreProduct(ctx, prod.ID))
+	r.Equal(ErrNotFound, repo.RestoreProduct(ctx, prod.ID))
+
+	loaded, err = repo.FindByID(ctx, prod.ID)
+	r.NoError(err)
+	r.Nil(loaded.DeletedAt)
+	r.Empty(loaded.DeletedBy)
+
+	r.NoError(repo.DeleteProduct(ctx, prod.ID, "admin", now))
+	r.NoError(repo.PurgeProduct(ctx, prod.ID, now))
+	r.Equal(ErrNotFound, repo.PurgeProduct(ctx, prod.ID, now))
+}
+
+func TestFindRate(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	r.NoError(repo.SaveRate(ctx, &Rate{From: "USD", To: "KZT", Rate: 420, EffectiveAt: now.Add(-48 * time.Hour)}))
+	r.NoError(repo.SaveRate(ctx, &Rate{From: "USD", To: "KZT", Rate: 430, EffectiveAt: now.Add(-24 * time.Hour)}))
+	r.NoError(repo.SaveRate(ctx, &Rate{From: "USD", To: "KZT", Rate: 440, EffectiveAt: now.Add(24 * time.Hour)}))
+
+	rate, err := repo.FindRate(ctx, "USD", "KZT", now)
+	r.NoError(err)
+	r.Equal(430.0, rate.Rate)
+
+	rate, err = repo.FindRate(ctx, "USD", "KZT", now.Add(-36*time.Hour))
+	r.NoError(err)
+	r.Equal(420.0, rate.Rate)
+
+	_, err = repo.FindRate(ctx, "USD", "KZT", now.Add(-72*time.Hour))
+	r.Equal(ErrNotFound, err)
+
+	_, err = repo.FindRate(ctx, "USD", "EUR", now)
+	r.Equal(ErrNotFound, err)
+
+	rates, err := repo.ListRates(ctx)
+	r.NoError(err)
+	r.Len(rates, 3)
+}
+
 func TestListProducts(t *testing.T) {
 	randomID := primitive.NewObjectID()
 
@@ -91,15 +500,15 @@ func TestListProducts(t *testing.T) {
 			Products: []*Product{
 				NewProduct(func(p *Product) {
 					p.Name = "Product1"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product2"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product3"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options:       &ListOptions{},
@@ -110,15 +519,15 @@ func TestListProducts(t *testing.T) {
 			Products: []*Product{
 				NewProduct(func(p *Product) {
 					p.Name = "Apple"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Juice"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Banana"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options:       &ListOptions{Sorting: SortByName, Direction: Asc},
@@ -129,15 +538,15 @@ func TestListProducts(t *testing.T) {
 			Products: []*Product{
 				NewProduct(func(p *Product) {
 					p.Name = "Apple"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Juice"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Banana"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options:       &ListOptions{Sorting: SortByPrice, Direction: Desc},
@@ -148,15 +557,15 @@ func TestListProducts(t *testing.T) {
 			Products: []*Product{
 				NewProduct(func(p *Product) {
 					p.Name = "Apple"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Juice"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Banana"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options:       &ListOptions{Sorting: SortByUpdatedAt, Direction: Desc},
@@ -167,15 +576,15 @@ func TestListProducts(t *testing.T) {
 			Products: []*Product{
 				NewProduct(func(p *Product) {
 					p.Name = "Product1"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product2"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product3"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options:       &ListOptions{Paging: &Pager{Limit: 1}},
@@ -187,15 +596,15 @@ func TestListProducts(t *testing.T) {
 				NewProduct(func(p *Product) {
 					p.ID = randomID
 					p.Name = "Product1"
-					p.Price = 1000
+					p.Price = MustParseAmount("1000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product2"
-					p.Price = 3000
+					p.Price = MustParseAmount("3000")
 				}),
 				NewProduct(func(p *Product) {
 					p.Name = "Product3"
-					p.Price = 2000
+					p.Price = MustParseAmount("2000")
 				}),
 			},
 			Options: &ListOptions{Paging: &Pager{
@@ -236,6 +645,158 @@ func TestListProducts(t *testing.T) {
 	}
 }
 
+func TestListProductsFilter(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i, p := range []struct {
+		name     string
+		prices   []string
+		currency string
+	}{
+		{name: "Apple iPhone 12", prices: []string{"999", "899"}, currency: "USD"},
+		{name: "Apple iPhone 12 PRO", prices: []string{"1099", "1049", "999"}, currency: "USD"},
+		{name: "Apple MacBook Pro", prices: []string{"1299"}, currency: "USD"},
+		{name: "Samsung Galaxy S20", prices: []string{"799"}, currency: "EUR"},
+	} {
+		for j, price := range p.prices {
+			r.NoError(repo.SaveProduct(ctx, NewProduct(func(prod *Product) {
+				prod.Name = p.name
+				prod.Price = MustParseAmount(price)
+				prod.Currency = p.currency
+				prod.UpdatedAt = now.Add(time.Duration(i+j) * time.Hour)
+			})))
+		}
+	}
+
+	amount := func(s string) *Amount {
+		a := MustParseAmount(s)
+		return &a
+	}
+
+	testCases := []struct {
+		Name     string
+		Filter   *Filter
+		Expected []string
+	}{
+		{
+			Name:     "NamePrefix",
+			Filter:   &Filter{NamePrefix: "Apple iPhone"},
+			Expected: []string{"Apple iPhone 12", "Apple iPhone 12 PRO"},
+		},
+		{
+			Name:     "NameContains",
+			Filter:   &Filter{NameContains: "pro"},
+			Expected: []string{"Apple iPhone 12 PRO", "Apple MacBook Pro"},
+		},
+		{
+			Name:     "NameRegex",
+			Filter:   &Filter{NameRegex: "^Apple .* Pro$"},
+			Expected: []string{"Apple MacBook Pro"},
+		},
+		{
+			Name:     "PriceRange",
+			Filter:   &Filter{MinPrice: amount("850"), MaxPrice: amount("1000")},
+			Expected: []string{"Apple iPhone 12", "Apple iPhone 12 PRO"},
+		},
+		{
+			Name:     "PriceCurrency",
+			Filter:   &Filter{MaxPrice: amount("1000"), Currency: "EUR"},
+			Expected: []string{"Samsung Galaxy S20"},
+		},
+		{
+			Name:     "UpdatedAfter",
+			Filter:   &Filter{UpdatedAfter: now.Add(2 * time.Hour)},
+			Expected: []string{"Apple iPhone 12 PRO", "Samsung Galaxy S20"},
+		},
+		{
+			Name:     "UpdatedBefore",
+			Filter:   &Filter{UpdatedBefore: now.Add(time.Hour)},
+			Expected: []string{},
+		},
+		{
+			Name:     "MinChanges",
+			Filter:   &Filter{MinChanges: 2},
+			Expected: []string{"Apple iPhone 12 PRO"},
+		},
+		{
+			Name:     "Combined",
+			Filter:   &Filter{NamePrefix: "Apple", MinChanges: 1, MaxPrice: amount("900")},
+			Expected: []string{"Apple iPhone 12"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			loaded, err := repo.ListProducts(ctx, &ListOptions{
+				Sorting:   SortByName,
+				Direction: Asc,
+				Filter:    tc.Filter,
+			})
+			r.NoError(err)
+
+			names := make([]string, 0, len(loaded))
+			for _, p := range loaded {
+				names = append(names, p.Name)
+			}
+			r.Equal(tc.Expected, names)
+		})
+	}
+}
+
+func TestBuildKeysetFilter(t *testing.T) {
+	var (
+		id   = primitive.NewObjectID()
+		opts = &ListOptions{
+			Sorting:   SortByPrice,
+			Direction: Asc,
+			ThenBy: []SortKey{
+				{Sorting: SortByName, Direction: Desc},
+				{Sorting: SortByPrice, Direction: Desc},
+			},
+			Paging: &Pager{Cursor: &Cursor{Values: []interface{}{10, "Apple"}, ID: id}},
+		}
+	)
+
+	r := require.New(t)
+
+	r.Equal(bson.D{{Key: "price", Value: 1}, {Key: "name", Value: -1}, {Key: "_id", Value: 1}}, buildSort(opts))
+
+	filter, err := buildKeysetFilter(opts)
+	r.NoError(err)
+	r.Equal(bson.M{"$or": bson.A{
+		bson.M{"price": bson.M{"$gt": 10}},
+		bson.M{"price": 10, "name": bson.M{"$lt": "Apple"}},
+		bson.M{"price": 10, "name": "Apple", "_id": bson.M{"$gt": id}},
+	}}, filter)
+
+	// backward paging reverses all keys
+	opts.Paging.Backward = true
+	r.Equal(bson.D{{Key: "price", Value: -1}, {Key: "name", Value: 1}, {Key: "_id", Value: -1}}, buildSort(opts))
+
+	filter, err = buildKeysetFilter(opts)
+	r.NoError(err)
+	r.Equal(bson.M{"price": 10, "name": bson.M{"$gt": "Apple"}}, filter["$or"].(bson.A)[1])
+
+	opts.Paging.Cursor.Values = []interface{}{10}
+	_, err = buildKeysetFilter(opts)
+	r.Error(err)
+}
+
 func testSortingOrder(t *testing.T, products []Product, opts *ListOptions) {
 	r := require.New(t)
 
@@ -251,9 +812,9 @@ func testSortingOrder(t *testing.T, products []Product, opts *ListOptions) {
 	case SortByPrice:
 		sorted := sort.SliceIsSorted(products, func(i, j int) bool {
 			if opts.Direction == Desc {
-				return products[i].Price > products[j].Price
+				return products[i].Price.Cmp(products[j].Price) > 0
 			}
-			return products[i].Price < products[j].Price
+			return products[i].Price.Cmp(products[j].Price) < 0
 		})
 		r.True(sorted)
 	case SortByUpdatedAt:
@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MoveDirection tells whether price increases or decreases are ranked.
+type MoveDirection int
+
+const (
+	MoveIncrease MoveDirection = iota
+	MoveDecrease
+)
+
+// MoveMeasure tells how price moves are compared.
+type MoveMeasure int
+
+const (
+	// MoveAbsolute compares price differences, which are comparable only
+	// within a single currency.
+	MoveAbsolute MoveMeasure = iota
+	// MovePercent compares price differences relative to the old price.
+	MovePercent
+)
+
+// MoversOptions selects products which prices moved the most in the window.
+type MoversOptions struct {
+	Since     time.Time
+	Until     time.Time
+	Direction MoveDirection
+	Measure   MoveMeasure
+	// Filter restricts ranked products by their current state.
+	Filter *Filter
+	Limit  int64
+}
+
+// Mover is a product with its net price move in the window: from the price
+// replaced by the first change in the window to the price set by the last
+// one. Products which currency was changed in between are not ranked.
+type Mover struct {
+	Product Product
+	// Currency of the prices, the current price may be in other one if
+	// it was changed after the window.
+	Currency string
+	From     Amount
+	To       Amount
+	// Change is negative for decreases, ChangePercent is zero if the old
+	// price is zero.
+	Change        Amount
+	ChangePercent float64
+}
+
+// move is the price move computed by the movers pipeline.
+type move struct {
+	Currency string   `bson:"currency"`
+	From     Amount   `bson:"from"`
+	To       Amount   `bson:"to"`
+	Change   Amount   `bson:"change"`
+	Percent  *float64 `bson:"percent"`
+}
+
+func (m *mongoRepo) TopMovers(ctx context.Context, opts *MoversOptions) ([]Mover, error) {
+	if opts == nil || opts.Since.IsZero() || opts.Until.Before(opts.Since) {
+		return nil, errInvalidData
+	}
+	if opts.Limit == 0 {
+		opts.Limit = 10
+	}
+
+	cursor, err := m.db().Collection("products").Aggregate(ctx, buildMoversPipeline(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	var found []struct {
+		Product `bson:",inline"`
+		Move    move `bson:"_move"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	movers := make([]Mover, 0, len(found))
+	for _, f := range found {
+		mover := Mover{
+			Product:  f.Product,
+			Currency: f.Move.Currency,
+			From:     f.Move.From,
+			To:       f.Move.To,
+			Change:   f.Move.Change,
+		}
+		if f.Move.Percent != nil {
+			mover.ChangePercent = *f.Move.Percent
+		}
+
+		movers = append(movers, mover)
+	}
+
+	return movers, nil
+}
+
+// buildMoversPipeline ranks products changed in the window by their net
+// price move, changes are looked up by the index on change time.
+func buildMoversPipeline(opts *MoversOptions) mongo.Pipeline {
+	var (
+		changes = bson.M{"$ifNull": bson.A{"$changes", bson.A{}}}
+		// first change after the time holds the price in effect at it
+		after = func(t time.Time) bson.M {
+			return bson.M{"$arrayElemAt": bson.A{
+				bson.M{"$filter": bson.M{"input": changes, "as": "c", "cond": bson.M{"$gt": bson.A{"$$c.changed_at", t}}}},
+				0,
+			}}
+		}
+		to = bson.M{"$ifNull": bson.A{"$_move.last", bson.M{"price": "$price", "currency": "$currency"}}}
+	)
+
+	window := bson.M{"changes": bson.M{"$elemMatch": bson.M{"changed_at": bson.M{"$gt": opts.Since, "$lte": opts.Until}}}}
+
+	var (
+		key    = "_move.change"
+		moved  = bson.M{"$gt": 0}
+		sortBy = -1
+	)
+	if opts.Measure == MovePercent {
+		key = "_move.percent"
+	}
+	if opts.Direction == MoveDecrease {
+		moved, sortBy = bson.M{"$lt": 0}, 1
+	}
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": bson.A{window, buildFilter(opts.Filter)}}}},
+		{{Key: "$addFields", Value: bson.M{"_move": bson.M{
+			"first": after(opts.Since),
+			"last":  after(opts.Until),
+		}}}},
+		{{Key: "$addFields", Value: bson.M{"_move": bson.M{"from": "$_move.first", "to": to}}}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$eq": bson.A{"$_move.from.currency", "$_move.to.currency"}}}}},
+		{{Key: "$addFields", Value: bson.M{"_move": bson.M{
+			"currency": "$_move.to.currency",
+			"from":     "$_move.from.price",
+			"to":       "$_move.to.price",
+			"change":   bson.M{"$subtract": bson.A{"$_move.to.price", "$_move.from.price"}},
+			"percent": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$_move.from.price", 0}},
+				nil,
+				bson.M{"$toDouble": bson.M{"$divide": bson.A{
+					bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{"$_move.to.price", "$_move.from.price"}}, 100}},
+					"$_move.from.price",
+				}}},
+			}},
+		}}}},
+		{{Key: "$match", Value: bson.M{key: moved}}},
+		{{Key: "$sort", Value: bson.D{{Key: key, Value: sortBy}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: opts.Limit}},
+	}
+}
@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTopMovers(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	var (
+		t0 = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(24 * time.Hour)
+		t2 = t1.Add(24 * time.Hour)
+		t3 = t2.Add(24 * time.Hour)
+	)
+
+	for _, save := range []struct {
+		Name     string
+		Price    string
+		Currency string
+		At       time.Time
+	}{
+		{"Apple iPhone 12", "1000", "USD", t0},
+		{"Apple iPhone 12", "900", "USD", t1},
+		{"Apple iPhone 12", "1100", "USD", t2},
+		{"Samsung Galaxy S21", "800", "USD", t0},
+		{"Samsung Galaxy S21", "600", "USD", t1},
+		{"Google Pixel 5", "100", "USD", t0},
+		{"Google Pixel 5", "150", "USD", t2},
+		{"Google Pixel 5", "200", "USD", t3},
+		{"Xiaomi Mi 11", "500", "USD", t0},
+		{"Xiaomi Mi 11", "450", "EUR", t1},
+		{"Nokia 3310", "50", "USD", t0},
+	} {
+		p := NewProduct(func(p *Product) {
+			p.Name = save.Name
+			p.Price = MustParseAmount(save.Price)
+			p.Currency = save.Currency
+			p.UpdatedAt = save.At
+		})
+		r.NoError(repo.SaveProduct(ctx, p))
+	}
+
+	agg := repo.(Aggregator)
+
+	top := func(opts *MoversOptions) []Mover {
+		movers, err := agg.TopMovers(ctx, opts)
+		r.NoError(err)
+		return movers
+	}
+
+	// iPhone moves from 1000 to 1100 with drop in between, Pixel moves from
+	// 100 to 150 as its last change is out of the window
+	movers := top(&MoversOptions{Since: t0, Until: t2})
+	r.Len(movers, 2)
+	r.Equal("Apple iPhone 12", movers[0].Product.Name)
+	r.Equal("1000", movers[0].From.String())
+	r.Equal("1100", movers[0].To.String())
+	r.Equal("100", movers[0].Change.String())
+	r.Equal("USD", movers[0].Currency)
+	r.Equal("Google Pixel 5", movers[1].Product.Name)
+	r.Equal("150", movers[1].To.String())
+	r.InDelta(50, movers[1].ChangePercent, 1e-9)
+
+	movers = top(&MoversOptions{Since: t0, Until: t2, Measure: MovePercent})
+	r.Len(movers, 2)
+	r.Equal("Google Pixel 5", movers[0].Product.Name)
+
+	movers = top(&MoversOptions{Since: t0, Until: t2, Direction: MoveDecrease})
+	r.Len(movers, 1)
+	r.Equal("Samsung Galaxy S21", movers[0].Product.Name)
+	r.Equal("-200", movers[0].Change.String())
+	r.InDelta(-25, movers[0].ChangePercent, 1e-9)
+
+	movers = top(&MoversOptions{Since: t0, Until: t1, Direction: MoveDecrease, Limit: 1})
+	r.Len(movers, 1)
+	r.Equal("Samsung Galaxy S21", movers[0].Product.Name)
+
+	movers = top(&MoversOptions{Since: t1, Until: t3, Filter: &Filter{NamePrefix: "Google"}})
+	r.Len(movers, 1)
+	r.Equal("200", movers[0].To.String())
+
+	_, err = agg.TopMovers(ctx, &MoversOptions{Since: t2, Until: t1})
+	r.Equal(errInvalidData, err)
+}
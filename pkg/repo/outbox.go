@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxEvent tells that product was created or its price was changed. It
+// is kept in the outbox until delivered to all the sinks.
+type OutboxEvent struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	ProductID primitive.ObjectID `bson:"product_id" json:"productId"`
+	Name      string             `bson:"name" json:"name"`
+	Price     Amount             `bson:"price" json:"price"`
+	Currency  string             `bson:"currency" json:"currency"`
+	// OldPrice is nil for created products.
+	OldPrice    *Amount   `bson:"old_price,omitempty" json:"oldPrice,omitempty"`
+	OldCurrency string    `bson:"old_currency,omitempty" json:"oldCurrency,omitempty"`
+	Actor       string    `bson:"actor,omitempty" json:"actor,omitempty"`
+	Reason      string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedAt   time.Time `bson:"changed_at" json:"changedAt"`
+	// Alert is set for events of triggered alerts.
+	Alert *TriggeredAlert `bson:"alert,omitempty" json:"alert,omitempty"`
+	// Delivery state is not a part of the event published to sinks.
+	Delivered     []string  `bson:"delivered,omitempty" json:"-"`
+	Attempts      int       `bson:"attempts" json:"-"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"-"`
+	LastError     string    `bson:"last_error,omitempty" json:"-"`
+}
+
+// Created reports whether event tells about created product.
+func (e *OutboxEvent) Created() bool {
+	return e.Alert == nil && e.OldPrice == nil
+}
+
+// IsDelivered reports whether event was delivered to the sink.
+func (e *OutboxEvent) IsDelivered(sink string) bool {
+	for _, name := range e.Delivered {
+		if name == sink {
+			return true
+		}
+	}
+	return false
+}
+
+func newOutboxEvent(id primitive.ObjectID, p *Product, prev *Change, o *saveOptions) *OutboxEvent {
+	e := &OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		ProductID:     id,
+		Name:          p.Name,
+		Price:         p.Price,
+		Currency:      p.Currency,
+		Actor:         o.actor,
+		Reason:        o.reason,
+		ChangedAt:     p.UpdatedAt,
+		NextAttemptAt: time.Now().UTC(),
+	}
+
+	if prev != nil {
+		e.OldPrice = &prev.Price
+		e.OldCurrency = prev.Currency
+	}
+
+	return e
+}
+
+func newAlertEvent(a *TriggeredAlert) *OutboxEvent {
+	e := &OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		ProductID:     a.ProductID,
+		Name:          a.Name,
+		Price:         a.Price,
+		Currency:      a.Currency,
+		OldPrice:      a.OldPrice,
+		ChangedAt:     a.TriggeredAt,
+		Alert:         a,
+		NextAttemptAt: time.Now().UTC(),
+	}
+
+	if a.OldPrice != nil {
+		e.OldCurrency = a.Currency
+	}
+
+	return e
+}
+
+// Outbox is implemented by repositories which record events to be relayed
+// to other systems.
+type Outbox interface {
+	// ClaimEvents returns events due at the moment and postpones their next
+	// attempt by the lease, so concurrent relays do not deliver them at the
+	// same time. Events are claimed again if the lease expires.
+	ClaimEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error)
+	// MarkDelivered records delivery of the event to the sink.
+	MarkDelivered(ctx context.Context, id primitive.ObjectID, sink string) error
+	// RetryEvent schedules the next attempt of undelivered event.
+	RetryEvent(ctx context.Context, id primitive.ObjectID, at time.Time, reason string) error
+	// CompleteEvent removes event delivered to all the sinks.
+	CompleteEvent(ctx context.Context, id primitive.ObjectID) error
+}
+
+func (m *mongoRepo) ClaimEvents(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxEvent, error) {
+	var (
+		coll   = m.db().Collection("outbox")
+		filter = bson.M{"next_attempt_at": bson.M{"$lte": now}}
+		update = bson.M{
+			"$set": bson.M{"next_attempt_at": now.Add(lease)},
+			"$inc": bson.M{"attempts": 1},
+		}
+		opts = options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After)
+	)
+
+	// events are claimed one by one, as many documents can not be updated
+	// and returned atomically
+	var events []OutboxEvent
+	for len(events) < limit {
+		var e OutboxEvent
+
+		err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&e)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+func (m *mongoRepo) MarkDelivered(ctx context.Context, id primitive.ObjectID, sink string) error {
+	return m.updateEvent(ctx, id, bson.M{"$addToSet": bson.M{"delivered": sink}})
+}
+
+func (m *mongoRepo) RetryEvent(ctx context.Context, id primitive.ObjectID, at time.Time, reason string) error {
+	return m.updateEvent(ctx, id, bson.M{"$set": bson.M{"next_attempt_at": at, "last_error": reason}})
+}
+
+func (m *mongoRepo) updateEvent(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	res, err := m.db().Collection("outbox").UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (m *mongoRepo) CompleteEvent(ctx context.Context, id primitive.ObjectID) error {
+	res, err := m.db().Collection("outbox").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// skipStandalone skips tests of features available on replica sets only.
+func skipStandalone(t *testing.T, conn *mongo.Client) {
+	var res struct {
+		SetName string `bson:"setName"`
+	}
+
+	err := conn.Database("admin").RunCommand(context.Background(), bson.M{"isMaster": 1}).Decode(&res)
+	require.NoError(t, err)
+
+	if res.SetName == "" {
+		t.Skip("mongo is not a replica set")
+	}
+}
+
+func TestSaveProductOutbox(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	skipStandalone(t, conn)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn, WithOutbox())
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	save := func(price string, opts ...SaveOption) error {
+		return repo.SaveProduct(ctx, NewProduct(func(p *Product) {
+			p.Name = "Apple iPhone 12"
+			p.Price = MustParseAmount(price)
+			p.UpdatedAt = time.Now().UTC()
+		}), opts...)
+	}
+
+	r.NoError(save("999", Pin(true)))
+	r.NoError(save("999"))
+	r.Equal(ErrPinned, save("899"))
+	r.NoError(save("899", WithAudit("admin", "sale"), Override()))
+
+	prod, err := repo.FindByName(ctx, "Apple iPhone 12")
+	r.NoError(err)
+
+	var (
+		outbox = repo.(Outbox)
+		now    = time.Now().UTC()
+	)
+
+	// unchanged and rejected prices are not recorded
+	events, err := outbox.ClaimEvents(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Len(events, 2)
+
+	r.True(events[0].Created())
+	r.Equal(prod.ID, events[0].ProductID)
+	r.Equal("999", events[0].Price.String())
+	r.Equal(1, events[0].Attempts)
+
+	r.False(events[1].Created())
+	r.Equal(prod.ID, events[1].ProductID)
+	r.Equal("899", events[1].Price.String())
+	r.Equal("999", events[1].OldPrice.String())
+	r.Equal("admin", events[1].Actor)
+	r.Equal("sale", events[1].Reason)
+
+	// claimed events are leased
+	leased, err := outbox.ClaimEvents(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Empty(leased)
+
+	r.NoError(outbox.MarkDelivered(ctx, events[0].ID, "log"))
+	r.NoError(outbox.MarkDelivered(ctx, events[0].ID, "log"))
+	r.NoError(outbox.RetryEvent(ctx, events[0].ID, now, "webhook: unavailable"))
+	r.NoError(outbox.CompleteEvent(ctx, events[1].ID))
+	r.Equal(ErrNotFound, outbox.CompleteEvent(ctx, events[1].ID))
+
+	events, err = outbox.ClaimEvents(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Len(events, 1)
+	r.Equal([]string{"log"}, events[0].Delivered)
+	r.Equal("webhook: unavailable", events[0].LastError)
+	r.Equal(2, events[0].Attempts)
+	r.True(events[0].IsDelivered("log"))
+	r.False(events[0].IsDelivered("webhook"))
+}
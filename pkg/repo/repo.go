@@ -3,19 +3,176 @@ package repo
 import (
 	"context"
 	"errors"
+	"math"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var errInvalidData = errors.New("repository: invalid input data")
+// DefaultCurrency is assumed for prices stored without a currency.
+const DefaultCurrency = "USD"
+
+var (
+	errInvalidData = errors.New("repository: invalid input data")
+
+	// ErrNotFound is returned when requested record does not exist.
+	ErrNotFound = errors.New("repository: not found")
+	// ErrRetained is returned when product can not be purged yet.
+	ErrRetained = errors.New("repository: product is retained")
+	// ErrPinned is returned when price of pinned product is changed without
+	// overriding it.
+	ErrPinned = errors.New("repository: product price is pinned")
+)
 
 type Product struct {
 	ID        primitive.ObjectID `bson:"_id" json:"id"`
 	Name      string             `bson:"name" json:"name"`
-	Price     float64            `bson:"price" json:"price"`
-	Changes   []float64          `bson:"changes" json:"changes"`
+	SKU       string             `bson:"sku,omitempty" json:"sku,omitempty"`
+	Price     Amount             `bson:"price" json:"price"`
+	Currency  string             `bson:"currency" json:"currency"`
+	Changes   []Change           `bson:"changes" json:"changes"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updatedAt"`
+	// NumOfChanges and LastChangePercent are denormalised from Changes by
+	// SaveProduct to make them indexable.
+	NumOfChanges      int64   `bson:"num_of_changes" json:"numOfChanges"`
+	LastChangePercent float64 `bson:"last_change_percent" json:"lastChangePercent"`
+	// DeletedAt is set for soft deleted products along with the actor who
+	// deleted them.
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy string     `bson:"deleted_by,omitempty" json:"deletedBy,omitempty"`
+	// Pinned price is locked by manual override and can be changed by
+	// another override only.
+	Pinned bool `bson:"pinned,omitempty" json:"pinned,omitempty"`
+	// LastSeenAt is the time of the last import which contained the
+	// product, it is zero for products never seen since tracking was
+	// introduced.
+	LastSeenAt time.Time `bson:"last_seen_at,omitempty" json:"lastSeenAt,omitempty"`
+	// Stale is set for products missing from imports for a long time, see
+	// StaleTracker.
+	Stale bool `bson:"stale,omitempty" json:"stale,omitempty"`
+}
+
+// PriceCurrency returns product currency or default one for legacy records.
+func (p *Product) PriceCurrency() string {
+	if p.Currency == "" {
+		return DefaultCurrency
+	}
+	return p.Currency
+}
+
+// lastChangePercent returns magnitude of the last price change in percents.
+// It is zero when currency was changed too, as prices are not comparable.
+func lastChangePercent(changes []Change, price Amount, currency string) float64 {
+	if len(changes) == 0 {
+		return 0
+	}
+
+	last := changes[len(changes)-1]
+	if last.PriceCurrency() != currency {
+		return 0
+	}
+
+	return math.Abs(ChangePercent(last.Price, price))
+}
+
+// Change holds previous price of the product. Entries recorded before
+// auditing was introduced have no time, actor and reason.
+type Change struct {
+	Price    Amount `bson:"price" json:"price"`
+	Currency string `bson:"currency" json:"currency"`
+	// ChangedAt is the time when the price was replaced by the next one.
+	ChangedAt time.Time `bson:"changed_at,omitempty" json:"changedAt,omitempty"`
+	Actor     string    `bson:"actor,omitempty" json:"actor,omitempty"`
+	Reason    string    `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// PriceCurrency returns currency of the price or default one for legacy
+// records.
+func (c *Change) PriceCurrency() string {
+	if c.Currency == "" {
+		return DefaultCurrency
+	}
+	return c.Currency
+}
+
+// UnmarshalBSONValue decodes change entry. Records created before currency
+// support hold bare price values, they are read with empty currency.
+func (c *Change) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t != bsontype.EmbeddedDocument {
+		var price Amount
+		if err := price.UnmarshalBSONValue(t, data); err != nil {
+			return err
+		}
+
+		*c = Change{Price: price}
+		return nil
+	}
+
+	type change Change
+	return bson.Unmarshal(data, (*change)(c))
+}
+
+// Rate holds exchange rate between two currencies starting from given date.
+type Rate struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	From        string             `bson:"from" json:"from"`
+	To          string             `bson:"to" json:"to"`
+	Rate        float64            `bson:"rate" json:"rate"`
+	EffectiveAt time.Time          `bson:"effective_at" json:"effectiveAt"`
+}
+
+// Quarantined holds imported price which violated validation rules and
+// waits for review before being applied.
+type Quarantined struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Price     Amount             `bson:"price" json:"price"`
+	Currency  string             `bson:"currency" json:"currency"`
+	Reason    string             `bson:"reason" json:"reason"`
+	Source    string             `bson:"source" json:"source"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// SaveOption configures how product is saved.
+type SaveOption func(*saveOptions)
+
+type saveOptions struct {
+	actor    string
+	reason   string
+	pin      *bool
+	override bool
+}
+
+func newSaveOptions(opts ...SaveOption) *saveOptions {
+	o := &saveOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAudit records who changed the price and why in the history.
+func WithAudit(actor, reason string) SaveOption {
+	return func(o *saveOptions) {
+		o.actor, o.reason = actor, reason
+	}
+}
+
+// Pin locks or unlocks price of the product.
+func Pin(pinned bool) SaveOption {
+	return func(o *saveOptions) {
+		o.pin = &pinned
+	}
+}
+
+// Override allows to change price of pinned product.
+func Override() SaveOption {
+	return func(o *saveOptions) {
+		o.override = true
+	}
 }
 
 type ProductOptions func(*Product)
@@ -44,17 +201,116 @@ const (
 	SortByName
 	SortByPrice
 	SortByUpdatedAt
+	SortByNumOfChanges
+	SortByLastChangePercent
+	SortByCreatedAt
 )
 
+// Cursor is a position in the list of products, it holds values of the
+// sorting keys and id of the product at the page boundary.
+type Cursor struct {
+	Values []interface{}      `bson:"v"`
+	ID     primitive.ObjectID `bson:"i"`
+}
+
 type Pager struct {
 	LastID primitive.ObjectID
-	Limit  int64
+	// Cursor lists products following the boundary in sorting order, or
+	// preceding it if Backward is set. Backward paging without cursor
+	// returns the last page. Products are returned in sorting order anyway.
+	Cursor   *Cursor
+	Backward bool
+	Limit    int64
+}
+
+// Filter restricts listed products, zero values are ignored.
+type Filter struct {
+	NamePrefix   string
+	NameContains string
+	NameRegex    string
+	// MinPrice and MaxPrice are compared with prices in Currency if it is
+	// set, otherwise with prices in any currency.
+	MinPrice      *Amount
+	MaxPrice      *Amount
+	Currency      string
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	MinChanges    int
+	// MinChangePercent matches products which last price change magnitude
+	// is at least the value.
+	MinChangePercent float64
+	// IncludeDeleted lists soft deleted products as well.
+	IncludeDeleted bool
+	// Stale lists stale products only.
+	Stale bool
+	// AsOf lists products as they were at the time, see Product.AsOf.
+	// Other fields are matched against the reconstructed products and
+	// the ones which price or creation time is unknown are skipped.
+	AsOf time.Time
+}
+
+// SortKey is a sorting field with its direction.
+type SortKey struct {
+	Sorting   SortingOption    `bson:"s"`
+	Direction SortingDirection `bson:"d"`
+}
+
+func (k SortKey) DirIndex() int {
+	if k.Direction == Asc {
+		return 1
+	}
+	return -1
+}
+
+// Field returns name of the sorting field, it is empty for default sorting.
+func (k SortKey) Field() string {
+	switch k.Sorting {
+	case SortByName:
+		return "name"
+	case SortByPrice:
+		return "price"
+	case SortByUpdatedAt:
+		return "updated_at"
+	case SortByNumOfChanges:
+		return "num_of_changes"
+	case SortByLastChangePercent:
+		return "last_change_percent"
+	case SortByCreatedAt:
+		return "created_at"
+	default:
+		return ""
+	}
+}
+
+func (k SortKey) value(p *Product) interface{} {
+	switch k.Sorting {
+	case SortByName:
+		return p.Name
+	case SortByPrice:
+		return p.Price
+	case SortByUpdatedAt:
+		return p.UpdatedAt
+	case SortByNumOfChanges:
+		return p.NumOfChanges
+	case SortByLastChangePercent:
+		return p.LastChangePercent
+	case SortByCreatedAt:
+		return p.CreatedAt
+	default:
+		return nil
+	}
 }
 
 type ListOptions struct {
 	Direction SortingDirection
 	Sorting   SortingOption
-	Paging    *Pager
+	// ThenBy sorts products with equal values of the preceding keys.
+	ThenBy []SortKey
+	Paging *Pager
+	Filter *Filter
+	// Fields lists stored fields to load, all of them are loaded if empty.
+	// Id and sorting fields are always loaded as they make up cursors.
+	Fields []string
 }
 
 func (o *ListOptions) DirIndex() int {
@@ -64,9 +320,65 @@ func (o *ListOptions) DirIndex() int {
 	return -1
 }
 
+// SortKeys returns all sorting keys in order of precedence, default and
+// repeated ones are skipped. Products are listed by id when it is empty.
+func (o *ListOptions) SortKeys() []SortKey {
+	var (
+		keys []SortKey
+		seen = make(map[SortingOption]bool)
+	)
+
+	for _, k := range append([]SortKey{{Sorting: o.Sorting, Direction: o.Direction}}, o.ThenBy...) {
+		if k.Sorting == SortByDefault || seen[k.Sorting] {
+			continue
+		}
+
+		seen[k.Sorting] = true
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// CursorOf returns position of the product in the list.
+func (o *ListOptions) CursorOf(p *Product) *Cursor {
+	c := &Cursor{ID: p.ID}
+	for _, k := range o.SortKeys() {
+		c.Values = append(c.Values, k.value(p))
+	}
+
+	return c
+}
+
+// Migrator is implemented by repositories which need to upgrade data
+// written by previous versions.
+type Migrator interface {
+	MigrateDecimalPrices(ctx context.Context) (int64, error)
+	MigrateChangeStats(ctx context.Context) (int64, error)
+}
+
+// Indexer is implemented by repositories which need indexes to be created
+// before serving requests.
+type Indexer interface {
+	EnsureIndexes(ctx context.Context) error
+}
+
 // Repository holds methods to save and retrieve product information.
 type Repository interface {
-	FindByName(ctx context.Context, name string) *Product
-	SaveProduct(ctx context.Context, p *Product) error
+	FindByName(ctx context.Context, name string) (*Product, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*Product, error)
+	FindBySKU(ctx context.Context, sku string) (*Product, error)
+	SaveProduct(ctx context.Context, p *Product, opts ...SaveOption) error
 	ListProducts(ctx context.Context, opts *ListOptions) ([]Product, error)
+	CountProducts(ctx context.Context, filter *Filter) (int64, error)
+	DeleteProduct(ctx context.Context, id primitive.ObjectID, actor string, at time.Time) error
+	RestoreProduct(ctx context.Context, id primitive.ObjectID) error
+	PurgeProduct(ctx context.Context, id primitive.ObjectID, deletedBefore time.Time) error
+	SaveRate(ctx context.Context, r *Rate) error
+	FindRate(ctx context.Context, from, to string, at time.Time) (*Rate, error)
+	ListRates(ctx context.Context) ([]Rate, error)
+	QuarantineProduct(ctx context.Context, q *Quarantined) error
+	FindQuarantined(ctx context.Context, id primitive.ObjectID) (*Quarantined, error)
+	ListQuarantined(ctx context.Context, paging *Pager) ([]Quarantined, error)
+	DeleteQuarantined(ctx context.Context, id primitive.ObjectID) error
 }
@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastChangePercent(t *testing.T) {
+	testCases := []struct {
+		Name     string
+		Changes  []Change
+		Price    string
+		Currency string
+		Expected float64
+	}{
+		{
+			Name:     "NoChanges",
+			Price:    "100",
+			Currency: "USD",
+			Expected: 0,
+		},
+		{
+			Name:     "Increase",
+			Changes:  []Change{{Price: MustParseAmount("50"), Currency: "USD"}, {Price: MustParseAmount("80"), Currency: "USD"}},
+			Price:    "100",
+			Currency: "USD",
+			Expected: 25,
+		},
+		{
+			Name:     "Decrease",
+			Changes:  []Change{{Price: MustParseAmount("200"), Currency: "EUR"}},
+			Price:    "150",
+			Currency: "EUR",
+			Expected: 25,
+		},
+		{
+			Name:     "LegacyCurrency",
+			Changes:  []Change{{Price: MustParseAmount("200")}},
+			Price:    "100",
+			Currency: DefaultCurrency,
+			Expected: 50,
+		},
+		{
+			Name:     "CurrencyChanged",
+			Changes:  []Change{{Price: MustParseAmount("100"), Currency: "USD"}},
+			Price:    "90",
+			Currency: "EUR",
+			Expected: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Expected, lastChangePercent(tc.Changes, MustParseAmount(tc.Price), tc.Currency))
+		})
+	}
+}
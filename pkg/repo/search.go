@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchOptions holds full-text query and offset based paging, results
+// are ranked by relevance so cursors are not applicable.
+type SearchOptions struct {
+	Query  string
+	Offset int64
+	Limit  int64
+}
+
+// SearchResult holds found product and its relevance score.
+type SearchResult struct {
+	Product Product
+	Score   float64
+}
+
+// Searcher is implemented by repositories with native full-text search.
+type Searcher interface {
+	SearchProducts(ctx context.Context, opts *SearchOptions) ([]SearchResult, error)
+}
+
+// Search runs full-text query using repository native search if available,
+// otherwise products are scanned and ranked by matching query terms.
+func Search(ctx context.Context, r Repository, opts *SearchOptions) ([]SearchResult, error) {
+	if opts == nil || strings.TrimSpace(opts.Query) == "" {
+		return nil, errInvalidData
+	}
+	if opts.Limit == 0 {
+		opts.Limit = 10
+	}
+
+	if s, ok := r.(Searcher); ok {
+		return s.SearchProducts(ctx, opts)
+	}
+
+	return scanSearch(ctx, r, opts)
+}
+
+func scanSearch(ctx context.Context, r Repository, opts *SearchOptions) ([]SearchResult, error) {
+	var (
+		terms   = tokenize(opts.Query)
+		results []SearchResult
+		paging  = &Pager{Limit: 100}
+	)
+
+	for {
+		products, err := r.ListProducts(ctx, &ListOptions{Paging: paging})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range products {
+			if score := scoreName(terms, p.Name); score > 0 {
+				results = append(results, SearchResult{Product: p, Score: score})
+			}
+		}
+
+		if int64(len(products)) < paging.Limit {
+			break
+		}
+		paging = &Pager{LastID: products[len(products)-1].ID, Limit: paging.Limit}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Product.Name < results[j].Product.Name
+	})
+
+	if opts.Offset >= int64(len(results)) {
+		return []SearchResult{}, nil
+	}
+
+	results = results[opts.Offset:]
+	if int64(len(results)) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+
+	return results, nil
+}
+
+// scoreName ranks name against query terms: whole word match weighs more
+// than prefix match, score is normalized by the number of words in name
+// so shorter names containing the same terms go first.
+func scoreName(terms []string, name string) float64 {
+	words := tokenize(name)
+	if len(words) == 0 {
+		return 0
+	}
+
+	var score float64
+	for _, term := range terms {
+		best := 0.0
+		for _, w := range words {
+			switch {
+			case w == term:
+				best = 1
+			case strings.HasPrefix(w, term) && best < 0.5:
+				best = 0.5
+			}
+		}
+		score += best
+	}
+
+	return score / float64(len(words))
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
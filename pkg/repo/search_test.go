@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestScoreName(t *testing.T) {
+	r := require.New(t)
+
+	terms := tokenize("iPhone PRO")
+	r.Equal([]string{"iphone", "pro"}, terms)
+
+	var (
+		exact  = scoreName(terms, "Apple iPhone 12 PRO")
+		longer = scoreName(terms, "Apple iPhone 12 PRO Max 256GB")
+		prefix = scoreName(terms, "Apple iPhone 12 Promo")
+		single = scoreName(terms, "Apple iPhone 12")
+	)
+
+	r.Greater(exact, longer)
+	r.Greater(exact, prefix)
+	r.Greater(exact, single)
+	r.Zero(scoreName(terms, "Samsung Galaxy S20"))
+	r.Zero(scoreName(terms, ""))
+}
+
+// plainRepo hides native search of the wrapped repository.
+type plainRepo struct{ Repository }
+
+func TestSearch(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	for _, name := range []string{
+		"Apple iPhone 12",
+		"Apple iPhone 12 PRO",
+		"Apple MacBook Pro",
+		"Samsung Galaxy S20",
+	} {
+		r.NoError(repo.SaveProduct(ctx, NewProduct(func(p *Product) {
+			p.Name = name
+			p.Price = MustParseAmount("999")
+		})))
+	}
+
+	testCases := []struct {
+		Name string
+		Repo Repository
+	}{
+		{Name: "Native", Repo: repo},
+		{Name: "Fallback", Repo: plainRepo{repo}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			results, err := Search(ctx, tc.Repo, &SearchOptions{Query: "iphone pro"})
+			r.NoError(err)
+			r.Len(results, 3)
+			r.Equal("Apple iPhone 12 PRO", results[0].Product.Name)
+
+			for i := 1; i < len(results); i++ {
+				r.GreaterOrEqual(results[i-1].Score, results[i].Score)
+			}
+
+			paged, err := Search(ctx, tc.Repo, &SearchOptions{Query: "iphone pro", Offset: 1, Limit: 1})
+			r.NoError(err)
+			r.Len(paged, 1)
+			r.Equal(results[1].Product.Name, paged[0].Product.Name)
+
+			none, err := Search(ctx, tc.Repo, &SearchOptions{Query: "nokia"})
+			r.NoError(err)
+			r.Empty(none)
+
+			_, err = Search(ctx, tc.Repo, &SearchOptions{Query: " "})
+			r.Error(err)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"time"
+)
+
+// SeriesOptions selects buckets of the price series. Buckets are aligned to
+// multiples of the interval in UTC, so daily buckets start at midnight and
+// weekly ones on Monday.
+type SeriesOptions struct {
+	From     time.Time
+	To       time.Time
+	Interval time.Duration
+}
+
+// PriceBucket summarises prices in effect within the bucket. Prices are in
+// the currency of the close price, prices in other currencies are skipped.
+type PriceBucket struct {
+	Start    time.Time
+	Currency string
+	Open     Amount
+	Close    Amount
+	Min      Amount
+	Max      Amount
+}
+
+// segment is a price in effect since the start until the next one.
+type segment struct {
+	start    time.Time
+	price    Amount
+	currency string
+}
+
+// segments returns prices of the product in order. History preceding the
+// last change without time is skipped, as it is not known when its prices
+// were in effect.
+func (p *Product) segments() []segment {
+	var (
+		n     = len(p.Changes)
+		segs  = make([]segment, 0, n+1)
+		start = p.CreatedAt
+	)
+
+	for i := 0; i <= n; i++ {
+		seg := segment{start: start, price: p.Price, currency: p.PriceCurrency()}
+		if i < n {
+			seg.price, seg.currency = p.Changes[i].Price, p.Changes[i].PriceCurrency()
+			start = p.Changes[i].ChangedAt
+		}
+
+		// the current price is set at the last update
+		if i == n && seg.start.IsZero() {
+			seg.start = p.UpdatedAt
+		}
+
+		if seg.start.IsZero() {
+			segs = segs[:0]
+			continue
+		}
+
+		segs = append(segs, seg)
+	}
+
+	return segs
+}
+
+// PriceSeries summarises prices of the product in buckets starting within
+// the range. Buckets before the product was created or before its history
+// is known from are omitted.
+func (p *Product) PriceSeries(opts *SeriesOptions) ([]PriceBucket, error) {
+	if opts == nil || opts.Interval <= 0 || !opts.From.Before(opts.To) {
+		return nil, errInvalidData
+	}
+
+	var (
+		segs    = p.segments()
+		buckets []PriceBucket
+	)
+
+	if len(segs) == 0 {
+		return buckets, nil
+	}
+
+	for start := opts.From.UTC().Truncate(opts.Interval); start.Before(opts.To); start = start.Add(opts.Interval) {
+		lo, hi := start, start.Add(opts.Interval)
+		if lo.Before(segs[0].start) {
+			lo = segs[0].start
+		}
+		if hi.After(opts.To) {
+			hi = opts.To
+		}
+		if !lo.Before(hi) {
+			continue
+		}
+
+		// segments in effect within the bucket
+		var in []segment
+		for i, seg := range segs {
+			if !seg.start.Before(hi) {
+				break
+			}
+			if i+1 < len(segs) && !segs[i+1].start.After(lo) {
+				continue
+			}
+			in = append(in, seg)
+		}
+
+		last := in[len(in)-1]
+		b := PriceBucket{Start: start, Currency: last.currency, Close: last.price}
+
+		first := true
+		for _, seg := range in {
+			if seg.currency != b.Currency {
+				continue
+			}
+
+			if first {
+				b.Open, b.Min, b.Max = seg.price, seg.price, seg.price
+				first = false
+				continue
+			}
+
+			if seg.price.Cmp(b.Min) < 0 {
+				b.Min = seg.price
+			}
+			if seg.price.Cmp(b.Max) > 0 {
+				b.Max = seg.price
+			}
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriceSeries(t *testing.T) {
+	var (
+		day = 24 * time.Hour
+		// Monday
+		t0 = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		at = func(d, h int) time.Time {
+			return t0.Add(time.Duration(d)*day + time.Duration(h)*time.Hour)
+		}
+	)
+
+	product := &Product{
+		Price:     MustParseAmount("950"),
+		Currency:  "USD",
+		CreatedAt: at(0, 12),
+		UpdatedAt: at(2, 6),
+		Changes: []Change{
+			{Price: MustParseAmount("1000"), Currency: "USD", ChangedAt: at(1, 6)},
+			{Price: MustParseAmount("900"), Currency: "USD", ChangedAt: at(1, 18)},
+			{Price: MustParseAmount("80000"), Currency: "KZT", ChangedAt: at(2, 6)},
+		},
+	}
+
+	type bucket struct {
+		Start                 time.Time
+		Currency              string
+		Open, Close, Min, Max string
+	}
+
+	testCases := []struct {
+		Name     string
+		Product  *Product
+		Options  *SeriesOptions
+		Expected []bucket
+	}{
+		{
+			Name:    "Daily",
+			Product: product,
+			Options: &SeriesOptions{From: t0.Add(-day), To: at(4, 0), Interval: day},
+			Expected: []bucket{
+				{at(0, 0), "USD", "1000", "1000", "1000", "1000"},
+				// only prices in currency of the close price are summarised
+				{at(1, 0), "KZT", "80000", "80000", "80000", "80000"},
+				{at(2, 0), "USD", "950", "950", "950", "950"},
+				{at(3, 0), "USD", "950", "950", "950", "950"},
+			},
+		},
+		{
+			Name:    "Hourly",
+			Product: product,
+			Options: &SeriesOptions{From: at(1, 5), To: at(1, 7).Add(30 * time.Minute), Interval: time.Hour},
+			Expected: []bucket{
+				{at(1, 5), "USD", "1000", "1000", "1000", "1000"},
+				{at(1, 6), "USD", "900", "900", "900", "900"},
+				{at(1, 7), "USD", "900", "900", "900", "900"},
+			},
+		},
+		{
+			Name:    "Weekly",
+			Product: product,
+			Options: &SeriesOptions{From: at(3, 0), To: at(8, 0), Interval: 7 * day},
+			Expected: []bucket{
+				{t0, "USD", "1000", "950", "900", "1000"},
+				{at(7, 0), "USD", "950", "950", "950", "950"},
+			},
+		},
+		{
+			Name:    "BeforeCreation",
+			Product: product,
+			Options: &SeriesOptions{From: t0.Add(-7 * day), To: t0, Interval: day},
+		},
+		{
+			Name: "Legacy",
+			Product: &Product{
+				Price:     MustParseAmount("10"),
+				UpdatedAt: at(1, 0),
+				Changes: []Change{
+					{Price: MustParseAmount("30")},
+					{Price: MustParseAmount("20"), Currency: "USD"},
+				},
+			},
+			Options: &SeriesOptions{From: t0, To: at(2, 0), Interval: day},
+			Expected: []bucket{
+				{at(1, 0), "USD", "10", "10", "10", "10"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			r := require.New(t)
+
+			buckets, err := tc.Product.PriceSeries(tc.Options)
+			r.NoError(err)
+			r.Len(buckets, len(tc.Expected))
+
+			for i, b := range buckets {
+				e := tc.Expected[i]
+				r.Equal(e.Start, b.Start, i)
+				r.Equal(e.Currency, b.Currency, i)
+				r.Equal(e.Open, b.Open.String(), i)
+				r.Equal(e.Close, b.Close.String(), i)
+				r.Equal(e.Min, b.Min.String(), i)
+				r.Equal(e.Max, b.Max.String(), i)
+			}
+		})
+	}
+
+	for _, opts := range []*SeriesOptions{
+		nil,
+		{From: t0, To: at(1, 0)},
+		{From: at(1, 0), To: t0, Interval: day},
+	} {
+		_, err := product.PriceSeries(opts)
+		require.Equal(t, errInvalidData, err)
+	}
+}
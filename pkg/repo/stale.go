@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StaleTracker is implemented by repositories which track presence of
+// products in imported feeds to detect the ones coming from dead feeds.
+type StaleTracker interface {
+	// MarkSeen records that products were contained in the feed imported
+	// at the time and clears their stale flag. Unknown names are ignored.
+	MarkSeen(ctx context.Context, names []string, at time.Time) (int64, error)
+	// MarkStale flags products not seen since the time. Products never
+	// seen since tracking was introduced are judged by the last update.
+	MarkStale(ctx context.Context, seenBefore time.Time) (int64, error)
+}
+
+func (m *mongoRepo) MarkSeen(ctx context.Context, names []string, at time.Time) (int64, error) {
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	var (
+		filter = bson.M{"name": bson.M{"$in": names}}
+		update = bson.M{
+			"$max":   bson.M{"last_seen_at": at},
+			"$unset": bson.M{"stale": ""},
+		}
+	)
+
+	res, err := m.db().Collection("products").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.MatchedCount, nil
+}
+
+func (m *mongoRepo) MarkStale(ctx context.Context, seenBefore time.Time) (int64, error) {
+	var (
+		filter = bson.M{
+			"stale":      bson.M{"$ne": true},
+			"deleted_at": bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"last_seen_at": bson.M{"$lt": seenBefore}},
+				bson.M{"last_seen_at": bson.M{"$exists": false}, "updated_at": bson.M{"$lt": seenBefore}},
+			},
+		}
+		update = bson.M{"$set": bson.M{"stale": true}}
+	)
+
+	res, err := m.db().Collection("products").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.ModifiedCount, nil
+}
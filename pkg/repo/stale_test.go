@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMarkStale(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	var (
+		now     = time.Now().UTC().Truncate(time.Millisecond)
+		day     = 24 * time.Hour
+		tracker = repo.(StaleTracker)
+	)
+
+	for _, p := range []struct {
+		name    string
+		updated time.Time
+	}{
+		{"Seen", now.Add(-10 * day)},
+		{"Unseen", now.Add(-10 * day)},
+		{"Legacy", now.Add(-10 * day)},
+		{"Fresh", now},
+	} {
+		r.NoError(repo.SaveProduct(ctx, NewProduct(func(prod *Product) {
+			prod.Name = p.name
+			prod.Price = MustParseAmount("100")
+			prod.UpdatedAt = p.updated
+		})))
+	}
+
+	n, err := tracker.MarkSeen(ctx, []string{"Seen", "Unseen", "Missing"}, now.Add(-5*day))
+	r.NoError(err)
+	r.Equal(int64(2), n)
+
+	n, err = tracker.MarkSeen(ctx, []string{"Seen"}, now)
+	r.NoError(err)
+	r.Equal(int64(1), n)
+
+	// last seen time is not moved back by delayed imports
+	_, err = tracker.MarkSeen(ctx, []string{"Seen"}, now.Add(-day))
+	r.NoError(err)
+
+	prod, err := repo.FindByName(ctx, "Seen")
+	r.NoError(err)
+	r.Equal(now, prod.LastSeenAt.UTC())
+
+	n, err = tracker.MarkStale(ctx, now.Add(-3*day))
+	r.NoError(err)
+	r.Equal(int64(2), n)
+
+	// already flagged products are not counted again
+	n, err = tracker.MarkStale(ctx, now.Add(-3*day))
+	r.NoError(err)
+	r.Zero(n)
+
+	products, err := repo.ListProducts(ctx, &ListOptions{
+		Sorting:   SortByName,
+		Direction: Asc,
+		Filter:    &Filter{Stale: true},
+	})
+	r.NoError(err)
+	r.Len(products, 2)
+	r.Equal("Legacy", products[0].Name)
+	r.Equal("Unseen", products[1].Name)
+	r.True(products[1].Stale)
+
+	count, err := repo.CountProducts(ctx, &Filter{Stale: true})
+	r.NoError(err)
+	r.Equal(int64(2), count)
+
+	// product is not stale anymore once it is seen again
+	_, err = tracker.MarkSeen(ctx, []string{"Unseen"}, now)
+	r.NoError(err)
+
+	prod, err = repo.FindByName(ctx, "Unseen")
+	r.NoError(err)
+	r.False(prod.Stale)
+	r.Equal(now, prod.LastSeenAt.UTC())
+}
@@ -0,0 +1,338 @@
+package repo
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PriceStats aggregates prices in a single currency, as prices in distinct
+// currencies are not comparable.
+type PriceStats struct {
+	Currency string
+	Count    int64
+	Min      Amount
+	Max      Amount
+	// Avg is rounded to nanos.
+	Avg Amount
+	// Median is the average of two middle prices for even count.
+	Median Amount
+}
+
+// CatalogueStats aggregates current prices of the products.
+type CatalogueStats struct {
+	Total int64
+	// Changed counts products which prices were changed since the window
+	// start, AvgChangePercent is the average magnitude of their last
+	// change in percents.
+	Changed          int64
+	AvgChangePercent float64
+	// Prices are grouped by currency and ordered by it.
+	Prices []PriceStats
+}
+
+// ProductStats aggregates price history of the product. Prices include the
+// current one and the previous ones in the current currency.
+type ProductStats struct {
+	ID              primitive.ObjectID
+	Name            string
+	Prices          PriceStats
+	NumOfChanges    int64
+	ChangesInWindow int64
+	// AvgChangePercent is the average magnitude of price changes made in
+	// the same currency.
+	AvgChangePercent float64
+}
+
+// Aggregator is implemented by repositories able to aggregate prices.
+type Aggregator interface {
+	// CatalogueStats aggregates products matching the filter, changes are
+	// counted since the given time.
+	CatalogueStats(ctx context.Context, filter *Filter, since time.Time) (*CatalogueStats, error)
+	// ProductStats aggregates history of the product with the name.
+	ProductStats(ctx context.Context, name string, since time.Time) (*ProductStats, error)
+	// TopMovers returns products which prices moved the most in the window
+	// in the given direction, ordered by the move.
+	TopMovers(ctx context.Context, opts *MoversOptions) ([]Mover, error)
+}
+
+// medianOf returns median of the sorted prices given their middle values,
+// which are the same for odd count.
+func medianOf(low, high Amount) Amount {
+	sum := new(big.Rat).Add(low.Rat(), high.Rat())
+
+	// mean of two amounts is within their range
+	median, _ := AmountFromRat(sum.Quo(sum, big.NewRat(2, 1)))
+	return median
+}
+
+// currencyOf returns currency expression with legacy records treated as
+// priced in the default currency.
+func currencyOf(field string) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{field, ""}}, field, DefaultCurrency}}
+}
+
+func (m *mongoRepo) CatalogueStats(ctx context.Context, f *Filter, since time.Time) (*CatalogueStats, error) {
+	filter := buildFilter(f)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "n"}},
+			"changed": bson.A{
+				bson.M{"$match": bson.M{"changes.changed_at": bson.M{"$gte": since}}},
+				bson.M{"$group": bson.M{
+					"_id":     nil,
+					"n":       bson.M{"$sum": 1},
+					"percent": bson.M{"$avg": "$last_change_percent"},
+				}},
+			},
+			"prices": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":   currencyOf("$currency"),
+					"count": bson.M{"$sum": 1},
+					"min":   bson.M{"$min": "$price"},
+					"max":   bson.M{"$max": "$price"},
+					"avg":   bson.M{"$avg": "$price"},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := m.db().Collection("products").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Changed []struct {
+			N       int64    `bson:"n"`
+			Percent *float64 `bson:"percent"`
+		} `bson:"changed"`
+		Prices []struct {
+			Currency string `bson:"_id"`
+			Count    int64  `bson:"count"`
+			Min      Amount `bson:"min"`
+			Max      Amount `bson:"max"`
+			Avg      Amount `bson:"avg"`
+		} `bson:"prices"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	stats := &CatalogueStats{Prices: make([]PriceStats, 0)}
+	if len(facets) == 0 {
+		return stats, nil
+	}
+
+	res := facets[0]
+	if len(res.Total) > 0 {
+		stats.Total = res.Total[0].N
+	}
+	if len(res.Changed) > 0 {
+		stats.Changed = res.Changed[0].N
+		if res.Changed[0].Percent != nil {
+			stats.AvgChangePercent = *res.Changed[0].Percent
+		}
+	}
+
+	for _, p := range res.Prices {
+		median, err := m.medianPrice(ctx, filter, p.Currency, p.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Prices = append(stats.Prices, PriceStats{
+			Currency: p.Currency,
+			Count:    p.Count,
+			Min:      p.Min,
+			Max:      p.Max,
+			Avg:      p.Avg,
+			Median:   median,
+		})
+	}
+
+	return stats, nil
+}
+
+// medianPrice reads middle prices in the currency using the index instead
+// of collecting all the prices into a single document.
+func (m *mongoRepo) medianPrice(ctx context.Context, filter bson.M, currency string, count int64) (Amount, error) {
+	var byCurrency interface{} = currency
+	if currency == DefaultCurrency {
+		byCurrency = bson.M{"$in": bson.A{currency, "", nil}}
+	}
+
+	fopts := options.Find().
+		SetSort(bson.D{{Key: "price", Value: 1}, {Key: "_id", Value: 1}}).
+		SetSkip((count - 1) / 2).
+		SetLimit(2 - count%2).
+		SetProjection(bson.M{"price": 1})
+
+	filter = bson.M{"$and": bson.A{filter, bson.M{"currency": byCurrency}}}
+
+	cursor, err := m.db().Collection("products").Find(ctx, filter, fopts)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	var middle []struct {
+		Price Amount `bson:"price"`
+	}
+	if err := cursor.All(ctx, &middle); err != nil {
+		return Amount{}, err
+	}
+
+	switch len(middle) {
+	case 0:
+		// products were removed since they were counted
+		return Amount{}, nil
+	case 1:
+		return middle[0].Price, nil
+	default:
+		return medianOf(middle[0].Price, middle[1].Price), nil
+	}
+}
+
+func (m *mongoRepo) ProductStats(ctx context.Context, name string, since time.Time) (*ProductStats, error) {
+	var (
+		changes = bson.M{"$ifNull": bson.A{"$changes", bson.A{}}}
+		// legacy entries hold bare prices
+		entry = bson.M{
+			"price": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{bson.M{"$type": "$$c"}, "object"}},
+				"$$c.price",
+				"$$c",
+			}},
+			"currency": currencyOf("$$c.currency"),
+		}
+		current = bson.M{"price": "$price", "currency": currencyOf("$currency")}
+		prev    = "$$value.prev"
+	)
+
+	comparable := bson.M{"$and": bson.A{
+		bson.M{"$ne": bson.A{prev, nil}},
+		bson.M{"$eq": bson.A{prev + ".currency", "$$this.currency"}},
+		bson.M{"$ne": bson.A{prev + ".price", 0}},
+	}}
+
+	percent := bson.M{"$abs": bson.M{"$toDouble": bson.M{"$divide": bson.A{
+		bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{"$$this.price", prev + ".price"}}, 100}},
+		prev + ".price",
+	}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"name": name}}},
+		{{Key: "$project", Value: bson.M{
+			"name":     1,
+			"currency": currencyOf("$currency"),
+			"history": bson.M{"$concatArrays": bson.A{
+				bson.M{"$map": bson.M{"input": changes, "as": "c", "in": entry}},
+				bson.A{current},
+			}},
+			"num_of_changes": bson.M{"$size": changes},
+			"changes_in_window": bson.M{"$size": bson.M{"$filter": bson.M{
+				"input": changes,
+				"as":    "c",
+				"cond":  bson.M{"$gte": bson.A{"$$c.changed_at", since}},
+			}}},
+		}}},
+		// consecutive prices in the same currency make up changes
+		{{Key: "$addFields", Value: bson.M{"changed": bson.M{"$reduce": bson.M{
+			"input":        "$history",
+			"initialValue": bson.M{"prev": nil, "sum": 0.0, "n": 0},
+			"in": bson.M{
+				"prev": "$$this",
+				"sum":  bson.M{"$cond": bson.A{comparable, bson.M{"$add": bson.A{"$$value.sum", percent}}, "$$value.sum"}},
+				"n":    bson.M{"$cond": bson.A{comparable, bson.M{"$add": bson.A{"$$value.n", 1}}, "$$value.n"}},
+			},
+		}}}}},
+		{{Key: "$unwind", Value: "$history"}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$eq": bson.A{"$history.currency", "$currency"}}}}},
+		{{Key: "$sort", Value: bson.M{"history.price": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               "$_id",
+			"name":              bson.M{"$first": "$name"},
+			"currency":          bson.M{"$first": "$currency"},
+			"num_of_changes":    bson.M{"$first": "$num_of_changes"},
+			"changes_in_window": bson.M{"$first": "$changes_in_window"},
+			"changed":           bson.M{"$first": "$changed"},
+			"count":             bson.M{"$sum": 1},
+			"min":               bson.M{"$min": "$history.price"},
+			"max":               bson.M{"$max": "$history.price"},
+			"avg":               bson.M{"$avg": "$history.price"},
+			"sorted":            bson.M{"$push": "$history.price"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"name":              1,
+			"currency":          1,
+			"num_of_changes":    1,
+			"changes_in_window": 1,
+			"count":             1,
+			"min":               1,
+			"max":               1,
+			"avg":               1,
+			"median_low":        bson.M{"$arrayElemAt": bson.A{"$sorted", bson.M{"$floor": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$count", 1}}, 2}}}}},
+			"median_high":       bson.M{"$arrayElemAt": bson.A{"$sorted", bson.M{"$floor": bson.M{"$divide": bson.A{"$count", 2}}}}},
+			"avg_change_percent": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{"$changed.n", 0}},
+				bson.M{"$divide": bson.A{"$changed.sum", "$changed.n"}},
+				0.0,
+			}},
+		}}},
+	}
+
+	cursor, err := m.db().Collection("products").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []struct {
+		ID               primitive.ObjectID `bson:"_id"`
+		Name             string             `bson:"name"`
+		Currency         string             `bson:"currency"`
+		NumOfChanges     int64              `bson:"num_of_changes"`
+		ChangesInWindow  int64              `bson:"changes_in_window"`
+		Count            int64              `bson:"count"`
+		Min              Amount             `bson:"min"`
+		Max              Amount             `bson:"max"`
+		Avg              Amount             `bson:"avg"`
+		MedianLow        Amount             `bson:"median_low"`
+		MedianHigh       Amount             `bson:"median_high"`
+		AvgChangePercent float64            `bson:"avg_change_percent"`
+	}
+	if err := cursor.All(ctx, &res); err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+
+	r := res[0]
+	return &ProductStats{
+		ID:   r.ID,
+		Name: r.Name,
+		Prices: PriceStats{
+			Currency: r.Currency,
+			Count:    r.Count,
+			Min:      r.Min,
+			Max:      r.Max,
+			Avg:      r.Avg,
+			Median:   medianOf(r.MedianLow, r.MedianHigh),
+		},
+		NumOfChanges:     r.NumOfChanges,
+		ChangesInWindow:  r.ChangesInWindow,
+		AvgChangePercent: r.AvgChangePercent,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMedianOf(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal("899", medianOf(MustParseAmount("899"), MustParseAmount("899")).String())
+	r.Equal("949.5", medianOf(MustParseAmount("899"), MustParseAmount("1000")).String())
+	r.Equal("0.000000001", medianOf(MustParseAmount("0"), MustParseAmount("0.000000001")).String())
+}
+
+func TestStats(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	var (
+		t0 = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(24 * time.Hour)
+		t2 = t1.Add(24 * time.Hour)
+	)
+
+	for _, save := range []struct {
+		Name     string
+		Price    string
+		Currency string
+		At       time.Time
+	}{
+		{"Apple iPhone 12", "1000", "USD", t0},
+		{"Apple iPhone 12", "900", "USD", t1},
+		{"Apple iPhone 12", "990", "USD", t2},
+		{"Samsung Galaxy S21", "800", "USD", t0},
+		{"Samsung Galaxy S21", "700", "EUR", t2},
+		{"Google Pixel 5", "600", "USD", t0},
+		{"Xiaomi Mi 11", "500", "USD", t0},
+	} {
+		p := NewProduct(func(p *Product) {
+			p.Name = save.Name
+			p.Price = MustParseAmount(save.Price)
+			p.Currency = save.Currency
+			p.UpdatedAt = save.At
+		})
+		r.NoError(repo.SaveProduct(ctx, p))
+	}
+
+	// legacy records hold bare prices without currency
+	_, err = conn.Database("productstore_test").Collection("products").InsertOne(ctx, &Product{
+		ID:      primitive.NewObjectID(),
+		Name:    "Nokia 3310",
+		Price:   MustParseAmount("49"),
+		Changes: []Change{{Price: MustParseAmount("59")}},
+	})
+	r.NoError(err)
+
+	agg := repo.(Aggregator)
+
+	stats, err := agg.CatalogueStats(ctx, nil, t2)
+	r.NoError(err)
+	r.Equal(int64(5), stats.Total)
+	r.Equal(int64(2), stats.Changed)
+	// 10% rise of iPhone, currency of Galaxy is changed
+	r.InDelta(5, stats.AvgChangePercent, 1e-9)
+	r.Len(stats.Prices, 2)
+
+	eur, usd := stats.Prices[0], stats.Prices[1]
+	r.Equal("EUR", eur.Currency)
+	r.Equal(int64(1), eur.Count)
+	r.Equal("700", eur.Median.String())
+	r.Equal("USD", usd.Currency)
+	r.Equal(int64(4), usd.Count)
+	r.Equal("49", usd.Min.String())
+	r.Equal("990", usd.Max.String())
+	r.Equal("534.75", usd.Avg.String())
+	r.Equal("550", usd.Median.String())
+
+	min := MustParseAmount("550")
+	stats, err = agg.CatalogueStats(ctx, &Filter{MinPrice: &min, Currency: "USD"}, t2)
+	r.NoError(err)
+	r.Equal(int64(2), stats.Total)
+	r.Equal("795", stats.Prices[0].Median.String())
+
+	ps, err := agg.ProductStats(ctx, "Apple iPhone 12", t1)
+	r.NoError(err)
+	r.Equal("Apple iPhone 12", ps.Name)
+	r.Equal(int64(2), ps.NumOfChanges)
+	r.Equal(int64(2), ps.ChangesInWindow)
+	r.Equal(int64(3), ps.Prices.Count)
+	r.Equal("900", ps.Prices.Min.String())
+	r.Equal("1000", ps.Prices.Max.String())
+	r.Equal("963.333333333", ps.Prices.Avg.String())
+	r.Equal("990", ps.Prices.Median.String())
+	r.InDelta(10, ps.AvgChangePercent, 1e-9)
+
+	ps, err = agg.ProductStats(ctx, "Samsung Galaxy S21", t2.Add(time.Second))
+	r.NoError(err)
+	r.Equal("EUR", ps.Prices.Currency)
+	r.Equal(int64(1), ps.Prices.Count)
+	r.Equal(int64(0), ps.ChangesInWindow)
+	r.Zero(ps.AvgChangePercent)
+
+	ps, err = agg.ProductStats(ctx, "Nokia 3310", t0)
+	r.NoError(err)
+	r.Equal(DefaultCurrency, ps.Prices.Currency)
+	r.Equal("54", ps.Prices.Median.String())
+	r.InDelta(16.949152542, ps.AvgChangePercent, 1e-9)
+
+	_, err = agg.ProductStats(ctx, "iPhone 13", t0)
+	r.Equal(ErrNotFound, err)
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrHistoryLost is returned when watching can not be resumed because events
+// following the resume token are not available anymore.
+var ErrHistoryLost = errors.New("repository: change history lost")
+
+// _changeStreamHistoryLost is returned by Mongo when resume token is older
+// than the oldest entry of the oplog.
+const _changeStreamHistoryLost = 286
+
+// ProductEvent is emitted when product is created or its price is changed.
+type ProductEvent struct {
+	// Token resumes watching right after the event.
+	Token   []byte
+	Product Product
+	Created bool
+	// Change holds the previous price, it is nil for created products.
+	Change *Change
+}
+
+// WatchOptions restricts watched events. Only name prefix and price bounds
+// of the filter are applied, prices are compared with the new price.
+type WatchOptions struct {
+	Filter *Filter
+	// ResumeAfter continues watching after the event with the token.
+	ResumeAfter []byte
+}
+
+// Watcher is implemented by repositories able to stream product changes
+// made by all the server instances.
+type Watcher interface {
+	// WatchProducts calls fn for each event until context is done or fn
+	// returns an error.
+	WatchProducts(ctx context.Context, opts *WatchOptions, fn func(*ProductEvent) error) error
+}
+
+// changeEvent is a change stream event of products collection.
+type changeEvent struct {
+	Token             bson.Raw `bson:"_id"`
+	OperationType     string   `bson:"operationType"`
+	FullDocument      *Product `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields priceUpdate `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// priceUpdate holds fields set by SaveProduct on price change.
+type priceUpdate struct {
+	Price     Amount    `bson:"price"`
+	Currency  string    `bson:"currency"`
+	Changes   []Change  `bson:"changes"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func (m *mongoRepo) WatchProducts(ctx context.Context, opts *WatchOptions, fn func(*ProductEvent) error) error {
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+
+	csOpts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if len(opts.ResumeAfter) > 0 {
+		csOpts.SetResumeAfter(bson.Raw(opts.ResumeAfter))
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: buildWatchFilter(opts.Filter)}}}
+
+	stream, err := m.db().Collection("products").Watch(ctx, pipeline, csOpts)
+	if isHistoryLost(err) {
+		return ErrHistoryLost
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var e changeEvent
+		if err := stream.Decode(&e); err != nil {
+			return err
+		}
+
+		// product was purged before the update was looked up
+		if e.FullDocument == nil {
+			continue
+		}
+
+		if err := fn(newProductEvent(&e)); err != nil {
+			return err
+		}
+	}
+
+	if isHistoryLost(stream.Err()) {
+		return ErrHistoryLost
+	}
+
+	return stream.Err()
+}
+
+func isHistoryLost(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == _changeStreamHistoryLost
+}
+
+func newProductEvent(e *changeEvent) *ProductEvent {
+	event := &ProductEvent{
+		Token:   []byte(e.Token),
+		Product: *e.FullDocument,
+		Created: e.OperationType == "insert",
+	}
+
+	if event.Created {
+		return event
+	}
+
+	// full document is looked up later, so it may already hold newer price
+	upd := e.UpdateDescription.UpdatedFields
+	event.Product.Price = upd.Price
+	event.Product.Currency = upd.Currency
+	event.Product.UpdatedAt = upd.UpdatedAt
+	event.Product.Changes = upd.Changes
+	event.Product.NumOfChanges = int64(len(upd.Changes))
+	event.Product.LastChangePercent = lastChangePercent(upd.Changes, upd.Price, upd.Currency)
+
+	if len(upd.Changes) > 0 {
+		event.Change = &upd.Changes[len(upd.Changes)-1]
+	}
+
+	return event
+}
+
+// buildWatchFilter matches inserts and price updates made by SaveProduct,
+// price bounds are checked against the inserted or the updated price.
+func buildWatchFilter(f *Filter) bson.M {
+	if f == nil {
+		f = &Filter{}
+	}
+
+	var (
+		insert = bson.M{"operationType": "insert"}
+		update = bson.M{
+			"operationType": "update",
+			"updateDescription.updatedFields.changes": bson.M{"$exists": true},
+		}
+	)
+
+	price := bson.M{}
+	if f.MinPrice != nil {
+		price["$gte"] = *f.MinPrice
+	}
+	if f.MaxPrice != nil {
+		price["$lte"] = *f.MaxPrice
+	}
+	if len(price) > 0 {
+		insert["fullDocument.price"] = price
+		update["updateDescription.updatedFields.price"] = price
+	}
+
+	if f.Currency != "" {
+		insert["fullDocument.currency"] = f.Currency
+		update["updateDescription.updatedFields.currency"] = f.Currency
+	}
+
+	filter := bson.M{"$or": bson.A{insert, update}}
+	if f.NamePrefix != "" {
+		filter["fullDocument.name"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.NamePrefix)}
+	}
+
+	return filter
+}
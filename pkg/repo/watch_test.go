@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestBuildWatchFilter(t *testing.T) {
+	r := require.New(t)
+
+	min := MustParseAmount("100")
+
+	filter := buildWatchFilter(&Filter{NamePrefix: "Apple (", MinPrice: &min, Currency: "USD"})
+	r.Equal(primitive.Regex{Pattern: `^Apple \(`}, filter["fullDocument.name"])
+	r.Equal(bson.A{
+		bson.M{
+			"operationType":         "insert",
+			"fullDocument.price":    bson.M{"$gte": min},
+			"fullDocument.currency": "USD",
+		},
+		bson.M{
+			"operationType": "update",
+			"updateDescription.updatedFields.changes":  bson.M{"$exists": true},
+			"updateDescription.updatedFields.price":    bson.M{"$gte": min},
+			"updateDescription.updatedFields.currency": "USD",
+		},
+	}, filter["$or"])
+
+	filter = buildWatchFilter(nil)
+	r.Len(filter, 1)
+}
+
+func TestNewProductEvent(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		now  = time.Now().UTC()
+		e    = &changeEvent{Token: bson.Raw{1}, OperationType: "update"}
+		prev = Change{Price: MustParseAmount("999"), Currency: "USD", Actor: "admin"}
+	)
+
+	// looked up document already has a newer price
+	e.FullDocument = &Product{Name: "Apple iPhone 12", Price: MustParseAmount("799"), Currency: "USD"}
+	e.UpdateDescription.UpdatedFields = priceUpdate{
+		Price:     MustParseAmount("899"),
+		Currency:  "USD",
+		Changes:   []Change{prev},
+		UpdatedAt: now,
+	}
+
+	event := newProductEvent(e)
+	r.False(event.Created)
+	r.Equal([]byte{1}, event.Token)
+	r.Equal("Apple iPhone 12", event.Product.Name)
+	r.Equal("899", event.Product.Price.String())
+	r.Equal(now, event.Product.UpdatedAt)
+	r.Equal(int64(1), event.Product.NumOfChanges)
+	r.Equal(&prev, event.Change)
+
+	e.OperationType = "insert"
+
+	event = newProductEvent(e)
+	r.True(event.Created)
+	r.Equal("799", event.Product.Price.String())
+	r.Nil(event.Change)
+}
+
+func TestWatchProducts(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	skipStandalone(t, conn)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	// take position of the stream before any change
+	stream, err := conn.Database("productstore_test").Collection("products").Watch(ctx, mongo.Pipeline{})
+	r.NoError(err)
+	start := stream.ResumeToken()
+	r.NoError(stream.Close(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+
+	save := func(name, price string, opts ...SaveOption) {
+		r.NoError(repo.SaveProduct(ctx, NewProduct(func(p *Product) {
+			p.Name = name
+			p.Price = MustParseAmount(price)
+			p.UpdatedAt = time.Now().UTC()
+		}), opts...))
+	}
+
+	save("Apple iPhone 12", "999")
+	save("Samsung Galaxy S20", "799")
+	save("Apple iPhone 12", "899", WithAudit("admin", "sale"))
+	save("Apple MacBook Pro", "99")
+
+	max := MustParseAmount("1000")
+	min := MustParseAmount("100")
+
+	watch := func(after []byte, n int) []*ProductEvent {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		var events []*ProductEvent
+		err := repo.(Watcher).WatchProducts(ctx, &WatchOptions{
+			Filter:      &Filter{NamePrefix: "Apple", MinPrice: &min, MaxPrice: &max},
+			ResumeAfter: after,
+		}, func(e *ProductEvent) error {
+			events = append(events, e)
+			if len(events) == n {
+				cancel()
+			}
+			return nil
+		})
+		r.True(err == nil || errors.Is(err, context.Canceled), err)
+
+		return events
+	}
+
+	events := watch(start, 2)
+	r.Len(events, 2)
+	r.True(events[0].Created)
+	r.Equal("999", events[0].Product.Price.String())
+	r.False(events[1].Created)
+	r.Equal("899", events[1].Product.Price.String())
+	r.Equal("999", events[1].Change.Price.String())
+	r.Equal("admin", events[1].Change.Actor)
+
+	// resumed right after the first event
+	events = watch(events[0].Token, 1)
+	r.Len(events, 1)
+	r.Equal("899", events[0].Product.Price.String())
+}
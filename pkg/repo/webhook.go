@@ -0,0 +1,318 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Subscription is a webhook registered by partner to receive price changes.
+type Subscription struct {
+	ID     primitive.ObjectID `bson:"_id"`
+	URL    string             `bson:"url"`
+	Secret string             `bson:"secret"`
+	Filter SubscriptionFilter `bson:"filter"`
+	// CreatedAt is set by SaveSubscription.
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// SubscriptionFilter restricts events sent to the webhook, zero values are
+// ignored. Price bounds are compared with the new price in Currency if it
+// is set, otherwise with the new price in any currency.
+type SubscriptionFilter struct {
+	NamePrefix string  `bson:"name_prefix,omitempty"`
+	MinPrice   *Amount `bson:"min_price,omitempty"`
+	MaxPrice   *Amount `bson:"max_price,omitempty"`
+	Currency   string  `bson:"currency,omitempty"`
+	// AlertOwner subscribes to alerts triggered by rules of the owner,
+	// alerts are not sent otherwise. Other fields do not apply to alerts.
+	AlertOwner string `bson:"alert_owner,omitempty"`
+}
+
+// Matches reports whether event passes the filter.
+func (f *SubscriptionFilter) Matches(e *OutboxEvent) bool {
+	if e.Alert != nil {
+		return f.AlertOwner != "" && f.AlertOwner == e.Alert.Owner
+	}
+
+	switch {
+	case !strings.HasPrefix(e.Name, f.NamePrefix):
+		return false
+	case f.Currency != "" && f.Currency != e.Currency:
+		return false
+	case f.MinPrice != nil && e.Price.Cmp(*f.MinPrice) < 0:
+		return false
+	case f.MaxPrice != nil && e.Price.Cmp(*f.MaxPrice) > 0:
+		return false
+	default:
+		return true
+	}
+}
+
+// DeliveryStatus is a state of the webhook delivery.
+type DeliveryStatus int
+
+const (
+	DeliveryPending DeliveryStatus = iota
+	DeliveryDelivered
+	// DeliveryDead is set when delivery is given up after too many failed
+	// attempts, it can be retried manually.
+	DeliveryDead
+)
+
+// Delivery is an event to be sent to the webhook along with its log.
+type Delivery struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	SubscriptionID primitive.ObjectID `bson:"subscription_id"`
+	// EventID is set by EnqueueDeliveries from the event.
+	EventID primitive.ObjectID `bson:"event_id"`
+	Event   OutboxEvent        `bson:"event"`
+	Status  DeliveryStatus     `bson:"status"`
+	// Failures counts failed attempts since delivery was enqueued or
+	// retried manually.
+	Failures      int               `bson:"failures"`
+	Attempts      []DeliveryAttempt `bson:"attempts,omitempty"`
+	CreatedAt     time.Time         `bson:"created_at"`
+	NextAttemptAt time.Time         `bson:"next_attempt_at"`
+	DeliveredAt   *time.Time        `bson:"delivered_at,omitempty"`
+}
+
+// DeliveryAttempt is a record of the webhook request.
+type DeliveryAttempt struct {
+	AttemptedAt time.Time `bson:"attempted_at"`
+	// StatusCode is zero if response was not received.
+	StatusCode int    `bson:"status_code,omitempty"`
+	Error      string `bson:"error,omitempty"`
+}
+
+// DeliveryFilter restricts listed deliveries, zero values are ignored.
+type DeliveryFilter struct {
+	SubscriptionID primitive.ObjectID
+	Statuses       []DeliveryStatus
+}
+
+// Webhooks is implemented by repositories which keep webhook subscriptions
+// and their deliveries.
+type Webhooks interface {
+	SaveSubscription(ctx context.Context, s *Subscription) error
+	FindSubscription(ctx context.Context, id primitive.ObjectID) (*Subscription, error)
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	// DeleteSubscription removes subscription along with its deliveries.
+	DeleteSubscription(ctx context.Context, id primitive.ObjectID) error
+	// EnqueueDeliveries saves pending deliveries, delivery of the same
+	// event to the same subscription is enqueued once.
+	EnqueueDeliveries(ctx context.Context, ds []Delivery) error
+	// ClaimDeliveries returns pending deliveries due at the moment and
+	// postpones their next attempt by the lease.
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Delivery, error)
+	// RecordAttempt appends attempt to the delivery log and sets its new
+	// status. Failures are counted unless delivery is delivered.
+	RecordAttempt(ctx context.Context, id primitive.ObjectID, a DeliveryAttempt, status DeliveryStatus, next time.Time) error
+	// RetryDelivery makes delivery pending again and resets its failures.
+	RetryDelivery(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	FindDelivery(ctx context.Context, id primitive.ObjectID) (*Delivery, error)
+	ListDeliveries(ctx context.Context, filter *DeliveryFilter, paging *Pager) ([]Delivery, error)
+}
+
+func (m *mongoRepo) SaveSubscription(ctx context.Context, s *Subscription) error {
+	if s == nil || s.URL == "" {
+		return errInvalidData
+	}
+
+	if s.ID.IsZero() {
+		s.ID = primitive.NewObjectID()
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now().UTC()
+	}
+
+	_, err := m.db().Collection("subscriptions").ReplaceOne(ctx, bson.M{"_id": s.ID}, s, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (m *mongoRepo) FindSubscription(ctx context.Context, id primitive.ObjectID) (*Subscription, error) {
+	var s Subscription
+
+	err := m.db().Collection("subscriptions").FindOne(ctx, bson.M{"_id": id}).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (m *mongoRepo) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	cursor, err := m.db().Collection("subscriptions").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var subs []Subscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (m *mongoRepo) DeleteSubscription(ctx context.Context, id primitive.ObjectID) error {
+	res, err := m.db().Collection("subscriptions").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	_, err = m.db().Collection("deliveries").DeleteMany(ctx, bson.M{"subscription_id": id})
+	return err
+}
+
+func (m *mongoRepo) EnqueueDeliveries(ctx context.Context, ds []Delivery) error {
+	coll := m.db().Collection("deliveries")
+
+	// upserts keep the existing delivery of redelivered event untouched
+	for i := range ds {
+		if ds[i].ID.IsZero() {
+			ds[i].ID = primitive.NewObjectID()
+		}
+
+		ds[i].EventID = ds[i].Event.ID
+
+		filter := bson.M{"subscription_id": ds[i].SubscriptionID, "event_id": ds[i].EventID}
+		update := bson.M{"$setOnInsert": ds[i]}
+
+		_, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil && !isDuplicateKey(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mongoRepo) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Delivery, error) {
+	var (
+		coll   = m.db().Collection("deliveries")
+		filter = bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+		update = bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+		opts   = options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}).
+			SetReturnDocument(options.After)
+	)
+
+	var ds []Delivery
+	for len(ds) < limit {
+		var d Delivery
+
+		err := coll.FindOneAndUpdate(ctx, filter, update, opts).Decode(&d)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
+
+func (m *mongoRepo) RecordAttempt(ctx context.Context, id primitive.ObjectID, a DeliveryAttempt, status DeliveryStatus, next time.Time) error {
+	update := bson.M{
+		"$set":  bson.M{"status": status, "next_attempt_at": next},
+		"$push": bson.M{"attempts": a},
+	}
+
+	if status == DeliveryDelivered {
+		update["$set"].(bson.M)["delivered_at"] = a.AttemptedAt
+	} else {
+		update["$inc"] = bson.M{"failures": 1}
+	}
+
+	return m.updateDelivery(ctx, bson.M{"_id": id}, update)
+}
+
+func (m *mongoRepo) RetryDelivery(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	var (
+		filter = bson.M{"_id": id, "status": DeliveryDead}
+		update = bson.M{"$set": bson.M{"status": DeliveryPending, "failures": 0, "next_attempt_at": at}}
+	)
+
+	return m.updateDelivery(ctx, filter, update)
+}
+
+func (m *mongoRepo) updateDelivery(ctx context.Context, filter, update bson.M) error {
+	res, err := m.db().Collection("deliveries").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (m *mongoRepo) FindDelivery(ctx context.Context, id primitive.ObjectID) (*Delivery, error) {
+	var d Delivery
+
+	err := m.db().Collection("deliveries").FindOne(ctx, bson.M{"_id": id}).Decode(&d)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (m *mongoRepo) ListDeliveries(ctx context.Context, f *DeliveryFilter, paging *Pager) ([]Delivery, error) {
+	if f == nil {
+		f = &DeliveryFilter{}
+	}
+	if paging == nil {
+		paging = &Pager{}
+	}
+	if paging.Limit == 0 {
+		paging.Limit = 10
+	}
+
+	filter := bson.M{}
+	if !f.SubscriptionID.IsZero() {
+		filter["subscription_id"] = f.SubscriptionID
+	}
+	if len(f.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": f.Statuses}
+	}
+	if !paging.LastID.IsZero() {
+		filter["_id"] = bson.M{"$gt": paging.LastID}
+	}
+
+	fopts := options.Find().SetSort(bson.M{"_id": 1}).SetLimit(paging.Limit)
+
+	cursor, err := m.db().Collection("deliveries").Find(ctx, filter, fopts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ds []Delivery
+	if err := cursor.All(ctx, &ds); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
+}
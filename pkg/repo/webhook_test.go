@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSubscriptionFilter(t *testing.T) {
+	var (
+		min = MustParseAmount("100")
+		max = MustParseAmount("1000")
+		e   = &OutboxEvent{Name: "Apple iPhone 12", Price: MustParseAmount("999"), Currency: "USD"}
+	)
+
+	testCases := []struct {
+		Name    string
+		Filter  SubscriptionFilter
+		Matches bool
+	}{
+		{Name: "Empty", Filter: SubscriptionFilter{}, Matches: true},
+		{Name: "Prefix", Filter: SubscriptionFilter{NamePrefix: "Apple"}, Matches: true},
+		{Name: "OtherPrefix", Filter: SubscriptionFilter{NamePrefix: "apple"}},
+		{Name: "Range", Filter: SubscriptionFilter{MinPrice: &min, MaxPrice: &max}, Matches: true},
+		{Name: "BelowMin", Filter: SubscriptionFilter{MinPrice: &max}},
+		{Name: "AboveMax", Filter: SubscriptionFilter{MaxPrice: &min}},
+		{Name: "Currency", Filter: SubscriptionFilter{MaxPrice: &max, Currency: "USD"}, Matches: true},
+		{Name: "OtherCurrency", Filter: SubscriptionFilter{MaxPrice: &max, Currency: "EUR"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			require.Equal(t, tc.Matches, tc.Filter.Matches(e))
+		})
+	}
+
+	// alerts are sent to subscribers of the owner only
+	alert := &OutboxEvent{Name: "Apple iPhone 12", Alert: &TriggeredAlert{Owner: "alice"}}
+	require.False(t, (&SubscriptionFilter{NamePrefix: "Apple"}).Matches(alert))
+	require.False(t, (&SubscriptionFilter{AlertOwner: "bob"}).Matches(alert))
+	require.True(t, (&SubscriptionFilter{AlertOwner: "alice", NamePrefix: "Samsung"}).Matches(alert))
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	r := require.New(t)
+
+	ctx := context.Background()
+
+	conn, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:27017"))
+	r.NoError(err)
+	r.NoError(conn.Connect(ctx))
+	defer conn.Disconnect(ctx)
+
+	r.NoError(conn.Database("productstore_test").Drop(ctx))
+
+	repo := NewMongoRepo("productstore_test", conn)
+	r.NoError(repo.(Indexer).EnsureIndexes(ctx))
+
+	w := repo.(Webhooks)
+
+	max := MustParseAmount("1000")
+	sub := &Subscription{URL: "https://example.com/hook", Secret: "secret", Filter: SubscriptionFilter{MaxPrice: &max}}
+	r.NoError(w.SaveSubscription(ctx, sub))
+
+	subs, err := w.ListSubscriptions(ctx)
+	r.NoError(err)
+	r.Len(subs, 1)
+	r.Equal("1000", subs[0].Filter.MaxPrice.String())
+
+	var (
+		now   = time.Now().UTC().Truncate(time.Millisecond)
+		event = OutboxEvent{ID: primitive.NewObjectID(), Name: "Apple iPhone 12", Price: MustParseAmount("999")}
+		queue = func() []Delivery {
+			return []Delivery{{SubscriptionID: sub.ID, Event: event, CreatedAt: now, NextAttemptAt: now}}
+		}
+	)
+
+	r.NoError(w.EnqueueDeliveries(ctx, queue()))
+	r.NoError(w.EnqueueDeliveries(ctx, queue()))
+
+	ds, err := w.ClaimDeliveries(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Len(ds, 1)
+	r.Equal(event.ID, ds[0].EventID)
+	r.Equal("999", ds[0].Event.Price.String())
+
+	// claimed delivery is leased
+	leased, err := w.ClaimDeliveries(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Empty(leased)
+
+	id := ds[0].ID
+	r.NoError(w.RecordAttempt(ctx, id, DeliveryAttempt{AttemptedAt: now, StatusCode: 500, Error: "failed"}, DeliveryDead, now))
+	r.Equal(ErrNotFound, w.RecordAttempt(ctx, primitive.NewObjectID(), DeliveryAttempt{}, DeliveryDead, now))
+
+	dead, err := w.ListDeliveries(ctx, &DeliveryFilter{SubscriptionID: sub.ID, Statuses: []DeliveryStatus{DeliveryDead}}, nil)
+	r.NoError(err)
+	r.Len(dead, 1)
+	r.Equal(1, dead[0].Failures)
+	r.Equal(500, dead[0].Attempts[0].StatusCode)
+
+	r.NoError(w.RetryDelivery(ctx, id, now))
+	r.Equal(ErrNotFound, w.RetryDelivery(ctx, id, now))
+
+	ds, err = w.ClaimDeliveries(ctx, now, time.Minute, 10)
+	r.NoError(err)
+	r.Len(ds, 1)
+	r.Zero(ds[0].Failures)
+
+	r.NoError(w.RecordAttempt(ctx, id, DeliveryAttempt{AttemptedAt: now, StatusCode: 200}, DeliveryDelivered, now))
+
+	d, err := w.FindDelivery(ctx, id)
+	r.NoError(err)
+	r.Equal(DeliveryDelivered, d.Status)
+	r.Len(d.Attempts, 2)
+	r.True(now.Equal(*d.DeliveredAt))
+
+	r.NoError(w.DeleteSubscription(ctx, sub.ID))
+	r.Equal(ErrNotFound, w.DeleteSubscription(ctx, sub.ID))
+
+	_, err = w.FindDelivery(ctx, id)
+	r.Equal(ErrNotFound, err)
+}
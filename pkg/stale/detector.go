@@ -0,0 +1,89 @@
+// Package stale flags products which are missing from imported feeds for a
+// long time, they may come from dead feeds.
+package stale
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+)
+
+// Options holds detector configuration, zero values are replaced by
+// defaults.
+type Options struct {
+	// Interval between checks of the catalogue.
+	Interval time.Duration
+	// After is time since the last import containing the product when it
+	// is considered stale.
+	After time.Duration
+	// OnError is called with errors which do not stop the detector.
+	OnError func(error)
+}
+
+const (
+	_defaultInterval = time.Hour
+	_defaultAfter    = 7 * 24 * time.Hour
+)
+
+// Detector periodically flags products not seen in any import for a
+// configured duration. Flags are cleared by imports containing products.
+type Detector struct {
+	store repo.StaleTracker
+	opts  Options
+	now   func() time.Time
+}
+
+// NewDetector returns detector of stale products.
+func NewDetector(store repo.StaleTracker, opts *Options) *Detector {
+	d := &Detector{
+		store: store,
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+
+	if opts != nil {
+		d.opts = *opts
+	}
+
+	if d.opts.Interval <= 0 {
+		d.opts.Interval = _defaultInterval
+	}
+	if d.opts.After <= 0 {
+		d.opts.After = _defaultAfter
+	}
+	if d.opts.OnError == nil {
+		d.opts.OnError = func(error) {}
+	}
+
+	return d
+}
+
+// Run checks the catalogue until context is done.
+func (d *Detector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Flush(ctx); err != nil && ctx.Err() == nil {
+			d.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush flags products which became stale at the moment, it returns number
+// of newly flagged products.
+func (d *Detector) Flush(ctx context.Context) (int, error) {
+	n, err := d.store.MarkStale(ctx, d.now().Add(-d.opts.After))
+	if err != nil {
+		return 0, fmt.Errorf("mark stale products: %w", err)
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,127 @@
+package stale
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryTracker keeps last seen times of products in memory the same way as
+// repository does.
+type memoryTracker struct {
+	seen  map[string]time.Time
+	stale map[string]bool
+	fail  error
+}
+
+func (m *memoryTracker) MarkSeen(ctx context.Context, names []string, at time.Time) (int64, error) {
+	var n int64
+	for _, name := range names {
+		if _, ok := m.seen[name]; !ok {
+			continue
+		}
+		if at.After(m.seen[name]) {
+			m.seen[name] = at
+		}
+		delete(m.stale, name)
+		n++
+	}
+	return n, nil
+}
+
+func (m *memoryTracker) MarkStale(ctx context.Context, seenBefore time.Time) (int64, error) {
+	if m.fail != nil {
+		return 0, m.fail
+	}
+
+	var n int64
+	for name, at := range m.seen {
+		if !m.stale[name] && at.Before(seenBefore) {
+			m.stale[name] = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestDetectorFlush(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx     = context.Background()
+		now     = time.Date(2021, 3, 10, 0, 0, 0, 0, time.UTC)
+		day     = 24 * time.Hour
+		tracker = &memoryTracker{
+			seen: map[string]time.Time{
+				"Apple iPhone 12":    now.Add(-10 * day),
+				"Samsung Galaxy S21": now.Add(-4 * day),
+				"Google Pixel 5":     now,
+			},
+			stale: make(map[string]bool),
+		}
+	)
+
+	d := NewDetector(tracker, &Options{After: 3 * day})
+	d.now = func() time.Time { return now }
+
+	n, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Equal(2, n)
+	r.True(tracker.stale["Apple iPhone 12"])
+	r.True(tracker.stale["Samsung Galaxy S21"])
+
+	n, err = d.Flush(ctx)
+	r.NoError(err)
+	r.Zero(n)
+
+	// products seen again are flagged once they are missing for long again
+	_, err = tracker.MarkSeen(ctx, []string{"Apple iPhone 12"}, now)
+	r.NoError(err)
+	r.False(tracker.stale["Apple iPhone 12"])
+
+	d.now = func() time.Time { return now.Add(4 * day) }
+
+	n, err = d.Flush(ctx)
+	r.NoError(err)
+	r.Equal(2, n)
+
+	tracker.fail = errors.New("unavailable")
+	_, err = d.Flush(ctx)
+	r.True(errors.Is(err, tracker.fail))
+}
+
+func TestDetectorRun(t *testing.T) {
+	r := require.New(t)
+
+	tracker := &memoryTracker{
+		seen:  map[string]time.Time{"Apple iPhone 12": time.Now().UTC().Add(-time.Hour)},
+		stale: make(map[string]bool),
+		fail:  errors.New("unavailable"),
+	}
+
+	errs := make(chan error, 1)
+	d := NewDetector(tracker, &Options{
+		Interval: time.Millisecond,
+		After:    time.Minute,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- d.Run(ctx) }()
+
+	r.True(errors.Is(<-errs, tracker.fail))
+	cancel()
+	r.Equal(context.Canceled, <-done)
+	r.False(tracker.stale["Apple iPhone 12"])
+}
@@ -0,0 +1,314 @@
+// Package webhook sends price change events to partner webhooks.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/outbox"
+	"github.com/danikarik/product-storage/pkg/repo"
+)
+
+const (
+	// SignatureHeader holds HMAC-SHA256 of the request body keyed by the
+	// subscription secret, formatted as "sha256=<hex>".
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader holds event id, which is the same for redelivered events.
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader holds delivery id.
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// Event types of the payload.
+const (
+	EventProductCreated = "product.created"
+	EventPriceChanged   = "price.changed"
+	EventAlertTriggered = "alert.triggered"
+)
+
+// Payload is a JSON body of the webhook request.
+type Payload struct {
+	ID   string            `json:"id"`
+	Type string            `json:"type"`
+	Data *repo.OutboxEvent `json:"data"`
+}
+
+// Options holds dispatcher configuration, zero values are replaced by
+// defaults.
+type Options struct {
+	// Interval between polls of pending deliveries.
+	Interval time.Duration
+	// BatchSize limits number of deliveries claimed at once.
+	BatchSize int
+	// Lease is time given to send claimed deliveries before other
+	// dispatchers can claim them.
+	Lease time.Duration
+	// Failed deliveries are retried with exponential backoff until they
+	// fail MaxAttempts times in a row, then they are dead-lettered.
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+	// Timeout of a single request.
+	Timeout time.Duration
+	// OnError is called with errors which do not stop the dispatcher.
+	OnError func(error)
+}
+
+const (
+	_defaultInterval    = time.Second
+	_defaultBatchSize   = 100
+	_defaultLease       = time.Minute
+	_defaultMinBackoff  = 10 * time.Second
+	_defaultMaxBackoff  = time.Hour
+	_defaultMaxAttempts = 10
+	_defaultTimeout     = 10 * time.Second
+)
+
+// Dispatcher is an outbox sink which enqueues events for matching
+// subscriptions, queued deliveries are sent by Run independently of each
+// other.
+type Dispatcher struct {
+	store  repo.Webhooks
+	client *http.Client
+	opts   Options
+	now    func() time.Time
+}
+
+// NewDispatcher returns webhook dispatcher.
+func NewDispatcher(store repo.Webhooks, client *http.Client, opts *Options) *Dispatcher {
+	d := &Dispatcher{
+		store:  store,
+		client: client,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+
+	if opts != nil {
+		d.opts = *opts
+	}
+
+	if d.client == nil {
+		d.client = &http.Client{}
+	}
+	if d.opts.Interval <= 0 {
+		d.opts.Interval = _defaultInterval
+	}
+	if d.opts.BatchSize <= 0 {
+		d.opts.BatchSize = _defaultBatchSize
+	}
+	if d.opts.Lease <= 0 {
+		d.opts.Lease = _defaultLease
+	}
+	if d.opts.MinBackoff <= 0 {
+		d.opts.MinBackoff = _defaultMinBackoff
+	}
+	if d.opts.MaxBackoff < d.opts.MinBackoff {
+		d.opts.MaxBackoff = _defaultMaxBackoff
+	}
+	if d.opts.MaxAttempts <= 0 {
+		d.opts.MaxAttempts = _defaultMaxAttempts
+	}
+	if d.opts.Timeout <= 0 {
+		d.opts.Timeout = _defaultTimeout
+	}
+	if d.opts.OnError == nil {
+		d.opts.OnError = func(error) {}
+	}
+
+	return d
+}
+
+func (d *Dispatcher) Name() string { return "webhooks" }
+
+// Deliver enqueues event for subscriptions it matches.
+func (d *Dispatcher) Deliver(ctx context.Context, e *repo.OutboxEvent) error {
+	subs, err := d.store.ListSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		now = d.now()
+		ds  []repo.Delivery
+	)
+
+	for _, s := range subs {
+		if !s.Filter.Matches(e) {
+			continue
+		}
+
+		ds = append(ds, repo.Delivery{
+			SubscriptionID: s.ID,
+			Event:          *e,
+			Status:         repo.DeliveryPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		})
+	}
+
+	if len(ds) == 0 {
+		return nil
+	}
+
+	return d.store.EnqueueDeliveries(ctx, ds)
+}
+
+// Run sends pending deliveries until context is done.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Flush(ctx); err != nil && ctx.Err() == nil {
+			d.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush sends all the deliveries due at the moment, it returns number of
+// successful ones.
+func (d *Dispatcher) Flush(ctx context.Context) (int, error) {
+	delivered := 0
+
+	for {
+		ds, err := d.store.ClaimDeliveries(ctx, d.now(), d.opts.Lease, d.opts.BatchSize)
+		if err != nil {
+			return delivered, fmt.Errorf("claim deliveries: %w", err)
+		}
+
+		for i := range ds {
+			ok, err := d.send(ctx, &ds[i])
+			if err != nil {
+				return delivered, err
+			}
+			if ok {
+				delivered++
+			}
+		}
+
+		if len(ds) < d.opts.BatchSize {
+			return delivered, nil
+		}
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *repo.Delivery) (bool, error) {
+	sub, err := d.store.FindSubscription(ctx, delivery.SubscriptionID)
+	if errors.Is(err, repo.ErrNotFound) {
+		// deliveries left behind by deleted subscription are given up,
+		// otherwise they would be claimed again after every lease
+		attempt := repo.DeliveryAttempt{AttemptedAt: d.now(), Error: "subscription not found"}
+		if err := d.store.RecordAttempt(ctx, delivery.ID, attempt, repo.DeliveryDead, attempt.AttemptedAt); err != nil {
+			return false, fmt.Errorf("record attempt of %s: %w", delivery.ID.Hex(), err)
+		}
+
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("find subscription %s: %w", delivery.SubscriptionID.Hex(), err)
+	}
+
+	attempt := d.post(ctx, sub, delivery)
+
+	var (
+		status = repo.DeliveryDelivered
+		next   = attempt.AttemptedAt
+	)
+
+	if attempt.Error != "" {
+		failures := delivery.Failures + 1
+
+		status = repo.DeliveryPending
+		next = attempt.AttemptedAt.Add(outbox.Backoff(d.opts.MinBackoff, d.opts.MaxBackoff, failures))
+
+		if failures >= d.opts.MaxAttempts {
+			status = repo.DeliveryDead
+		}
+	}
+
+	if err := d.store.RecordAttempt(ctx, delivery.ID, attempt, status, next); err != nil {
+		return false, fmt.Errorf("record attempt of %s: %w", delivery.ID.Hex(), err)
+	}
+
+	return status == repo.DeliveryDelivered, nil
+}
+
+// post sends delivery and returns its record, any response other than 2xx
+// is a failure.
+func (d *Dispatcher) post(ctx context.Context, sub *repo.Subscription, delivery *repo.Delivery) repo.DeliveryAttempt {
+	attempt := repo.DeliveryAttempt{AttemptedAt: d.now()}
+
+	body, err := json.Marshal(NewPayload(&delivery.Event))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, body))
+	req.Header.Set(EventHeader, delivery.Event.ID.Hex())
+	req.Header.Set(DeliveryHeader, delivery.ID.Hex())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	// drain body to reuse the connection
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+
+	return attempt
+}
+
+// NewPayload returns body of the webhook request for the event.
+func NewPayload(e *repo.OutboxEvent) *Payload {
+	p := &Payload{ID: e.ID.Hex(), Type: EventPriceChanged, Data: e}
+
+	switch {
+	case e.Alert != nil:
+		p.Type = EventAlertTriggered
+	case e.Created():
+		p.Type = EventProductCreated
+	}
+
+	return p
+}
+
+// Sign returns signature of the body, receivers should compare it with the
+// signature header using hmac.Equal.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
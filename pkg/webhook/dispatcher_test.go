@@ -0,0 +1,381 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/danikarik/product-storage/pkg/repo"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryWebhooks keeps subscriptions and deliveries in memory the same way
+// as repository does.
+type memoryWebhooks struct {
+	subs       []repo.Subscription
+	deliveries []*repo.Delivery
+}
+
+func (m *memoryWebhooks) SaveSubscription(ctx context.Context, s *repo.Subscription) error {
+	s.ID = primitive.NewObjectID()
+	m.subs = append(m.subs, *s)
+	return nil
+}
+
+func (m *memoryWebhooks) FindSubscription(ctx context.Context, id primitive.ObjectID) (*repo.Subscription, error) {
+	for i := range m.subs {
+		if m.subs[i].ID == id {
+			return &m.subs[i], nil
+		}
+	}
+	return nil, repo.ErrNotFound
+}
+
+func (m *memoryWebhooks) ListSubscriptions(ctx context.Context) ([]repo.Subscription, error) {
+	return m.subs, nil
+}
+
+func (m *memoryWebhooks) DeleteSubscription(ctx context.Context, id primitive.ObjectID) error {
+	return nil
+}
+
+func (m *memoryWebhooks) EnqueueDeliveries(ctx context.Context, ds []repo.Delivery) error {
+	for i := range ds {
+		ds[i].EventID = ds[i].Event.ID
+
+		if m.find(ds[i].SubscriptionID, ds[i].EventID) == nil {
+			ds[i].ID = primitive.NewObjectID()
+			d := ds[i]
+			m.deliveries = append(m.deliveries, &d)
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) find(sub, event primitive.ObjectID) *repo.Delivery {
+	for _, d := range m.deliveries {
+		if d.SubscriptionID == sub && d.EventID == event {
+			return d
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repo.Delivery, error) {
+	var claimed []repo.Delivery
+	for _, d := range m.deliveries {
+		if len(claimed) < limit && d.Status == repo.DeliveryPending && !d.NextAttemptAt.After(now) {
+			d.NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, *d)
+		}
+	}
+
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID.Hex() < claimed[j].ID.Hex() })
+	return claimed, nil
+}
+
+func (m *memoryWebhooks) RecordAttempt(ctx context.Context, id primitive.ObjectID, a repo.DeliveryAttempt, status repo.DeliveryStatus, next time.Time) error {
+	d, err := m.FindDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	d.Attempts = append(d.Attempts, a)
+	d.Status, d.NextAttemptAt = status, next
+	if status == repo.DeliveryDelivered {
+		d.DeliveredAt = &a.AttemptedAt
+	} else {
+		d.Failures++
+	}
+	return nil
+}
+
+func (m *memoryWebhooks) RetryDelivery(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	d, err := m.FindDelivery(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	d.Status, d.Failures, d.NextAttemptAt = repo.DeliveryPending, 0, at
+	return nil
+}
+
+func (m *memoryWebhooks) FindDelivery(ctx context.Context, id primitive.ObjectID) (*repo.Delivery, error) {
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return nil, repo.ErrNotFound
+}
+
+func (m *memoryWebhooks) ListDeliveries(ctx context.Context, filter *repo.DeliveryFilter, paging *repo.Pager) ([]repo.Delivery, error) {
+	return nil, nil
+}
+
+// receiver is a webhook endpoint responding with given status codes, the
+// last one is repeated.
+type receiver struct {
+	secret   string
+	statuses []int
+	received []*http.Request
+	payloads []Payload
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if !hmac.Equal([]byte(Sign(rc.secret, body)), []byte(r.Header.Get(SignatureHeader))) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rc.received = append(rc.received, r)
+	rc.payloads = append(rc.payloads, p)
+
+	code := rc.statuses[0]
+	if len(rc.statuses) > 1 {
+		rc.statuses = rc.statuses[1:]
+	}
+
+	w.WriteHeader(code)
+}
+
+func testEvent(name, price string) *repo.OutboxEvent {
+	old := repo.MustParseAmount("999")
+
+	return &repo.OutboxEvent{
+		ID:          primitive.NewObjectID(),
+		ProductID:   primitive.NewObjectID(),
+		Name:        name,
+		Price:       repo.MustParseAmount(price),
+		Currency:    "USD",
+		OldPrice:    &old,
+		OldCurrency: "USD",
+		Actor:       "admin",
+	}
+}
+
+func TestSign(t *testing.T) {
+	require.Equal(t,
+		"sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")),
+	)
+}
+
+func TestNewPayload(t *testing.T) {
+	r := require.New(t)
+
+	e := testEvent("Apple iPhone 12", "899")
+	r.Equal(EventPriceChanged, NewPayload(e).Type)
+
+	e.Alert = &repo.TriggeredAlert{Owner: "alice"}
+	r.Equal(EventAlertTriggered, NewPayload(e).Type)
+
+	e.Alert, e.OldPrice = nil, nil
+	r.Equal(EventProductCreated, NewPayload(e).Type)
+}
+
+func TestDispatcher(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx   = context.Background()
+		now   = time.Now().UTC()
+		store = &memoryWebhooks{}
+		apple = &receiver{secret: "apple", statuses: []int{http.StatusServiceUnavailable, http.StatusOK}}
+		other = &receiver{secret: "other", statuses: []int{http.StatusOK}}
+	)
+
+	appleSrv := httptest.NewServer(apple)
+	defer appleSrv.Close()
+
+	otherSrv := httptest.NewServer(other)
+	defer otherSrv.Close()
+
+	max := repo.MustParseAmount("1000")
+
+	r.NoError(store.SaveSubscription(ctx, &repo.Subscription{
+		URL:    appleSrv.URL,
+		Secret: "apple",
+		Filter: repo.SubscriptionFilter{NamePrefix: "Apple", MaxPrice: &max},
+	}))
+	r.NoError(store.SaveSubscription(ctx, &repo.Subscription{URL: otherSrv.URL, Secret: "other"}))
+
+	d := NewDispatcher(store, appleSrv.Client(), &Options{MinBackoff: time.Second})
+	d.now = func() time.Time { return now }
+
+	var (
+		iphone = testEvent("Apple iPhone 12", "899")
+		galaxy = testEvent("Samsung Galaxy S20", "799")
+		mac    = testEvent("Apple MacBook Pro", "1999")
+	)
+
+	for _, e := range []*repo.OutboxEvent{iphone, galaxy, mac, iphone} {
+		r.NoError(d.Deliver(ctx, e))
+	}
+
+	// redelivered event is enqueued once
+	r.Len(store.deliveries, 4)
+
+	n, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Equal(3, n)
+	r.Len(other.payloads, 3)
+	r.Len(apple.payloads, 1)
+
+	p := apple.payloads[0]
+	r.Equal(iphone.ID.Hex(), p.ID)
+	r.Equal(EventPriceChanged, p.Type)
+	r.Equal("899", p.Data.Price.String())
+	r.Equal("999", p.Data.OldPrice.String())
+	r.Equal(iphone.ID.Hex(), apple.received[0].Header.Get(EventHeader))
+	r.Equal("application/json", apple.received[0].Header.Get("Content-Type"))
+
+	failed := store.find(store.subs[0].ID, iphone.ID)
+	r.Equal(repo.DeliveryPending, failed.Status)
+	r.Equal(1, failed.Failures)
+	r.Equal(http.StatusServiceUnavailable, failed.Attempts[0].StatusCode)
+	r.Equal("unexpected status 503 Service Unavailable", failed.Attempts[0].Error)
+	r.Equal(now.Add(time.Second), failed.NextAttemptAt)
+
+	// retried after backoff
+	now = now.Add(time.Second)
+
+	n, err = d.Flush(ctx)
+	r.NoError(err)
+	r.Equal(1, n)
+	r.Len(apple.payloads, 2)
+	r.Equal(apple.received[0].Header.Get(EventHeader), apple.received[1].Header.Get(EventHeader))
+	r.Equal(repo.DeliveryDelivered, failed.Status)
+	r.Len(failed.Attempts, 2)
+	r.Equal(now, *failed.DeliveredAt)
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx   = context.Background()
+		now   = time.Now().UTC()
+		store = &memoryWebhooks{}
+		rc    = &receiver{secret: "secret", statuses: []int{http.StatusInternalServerError}}
+	)
+
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	r.NoError(store.SaveSubscription(ctx, &repo.Subscription{URL: srv.URL, Secret: "secret"}))
+
+	d := NewDispatcher(store, srv.Client(), &Options{MinBackoff: time.Second, MaxAttempts: 3})
+	d.now = func() time.Time { return now }
+
+	r.NoError(d.Deliver(ctx, testEvent("Apple iPhone 12", "899")))
+
+	delivery := store.deliveries[0]
+	for i := 0; i < 3; i++ {
+		n, err := d.Flush(ctx)
+		r.NoError(err)
+		r.Zero(n)
+
+		now = delivery.NextAttemptAt
+	}
+
+	r.Equal(repo.DeliveryDead, delivery.Status)
+	r.Len(delivery.Attempts, 3)
+
+	// dead deliveries are not attempted anymore
+	now = now.Add(time.Hour)
+
+	_, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Len(rc.received, 3)
+
+	// manual retry resets failures
+	rc.statuses = []int{http.StatusNoContent}
+	r.NoError(store.RetryDelivery(ctx, delivery.ID, now))
+
+	n, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Equal(1, n)
+	r.Equal(repo.DeliveryDelivered, delivery.Status)
+}
+
+func TestDispatcherUnreachable(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx   = context.Background()
+		store = &memoryWebhooks{}
+	)
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	r.NoError(store.SaveSubscription(ctx, &repo.Subscription{URL: srv.URL}))
+
+	d := NewDispatcher(store, nil, nil)
+	r.NoError(d.Deliver(ctx, testEvent("Apple iPhone 12", "899")))
+
+	n, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Zero(n)
+
+	attempt := store.deliveries[0].Attempts[0]
+	r.Zero(attempt.StatusCode)
+	r.NotEmpty(attempt.Error)
+}
+
+func TestDispatcherOrphan(t *testing.T) {
+	r := require.New(t)
+
+	var (
+		ctx   = context.Background()
+		now   = time.Now().UTC()
+		store = &memoryWebhooks{}
+		rc    = &receiver{secret: "secret", statuses: []int{http.StatusOK}}
+	)
+
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	r.NoError(store.SaveSubscription(ctx, &repo.Subscription{URL: srv.URL, Secret: "secret"}))
+
+	d := NewDispatcher(store, srv.Client(), nil)
+	d.now = func() time.Time { return now }
+
+	r.NoError(d.Deliver(ctx, testEvent("Apple iPhone 12", "899")))
+
+	// subscription is deleted while its delivery is left behind
+	store.subs = nil
+
+	n, err := d.Flush(ctx)
+	r.NoError(err)
+	r.Zero(n)
+
+	delivery := store.deliveries[0]
+	r.Equal(repo.DeliveryDead, delivery.Status)
+	r.Len(delivery.Attempts, 1)
+	r.NotEmpty(delivery.Attempts[0].Error)
+
+	// orphaned delivery is not claimed again after the lease
+	now = now.Add(time.Hour)
+
+	_, err = d.Flush(ctx)
+	r.NoError(err)
+	r.Len(delivery.Attempts, 1)
+	r.Empty(rc.received)
+}